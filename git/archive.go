@@ -0,0 +1,37 @@
+package git
+
+import (
+	"io"
+)
+
+// ArchiveOptions controls what Ref.Archive writes.
+type ArchiveOptions struct {
+	// Format is the archive format, such as "tar", "tar.gz", or "zip".
+	// If empty, git writes a tar archive.
+	Format string
+	// Prefix is prepended to every path in the archive.
+	// It should usually end in a /.
+	Prefix string
+	// Paths limits the archive to these pathspecs.
+	Paths []string
+}
+
+// Archive writes an archive of the tree at this ref to w.
+// The archive is streamed straight from git to w, without
+// being buffered in memory or needing a checkout.
+func (r *Ref) Archive(w io.Writer, opts ArchiveOptions) (err error) {
+	args := []string{}
+	if opts.Format != "" {
+		args = append(args, "--format="+opts.Format)
+	}
+	if opts.Prefix != "" {
+		args = append(args, "--prefix="+opts.Prefix)
+	}
+	args = append(args, r.SHA)
+	if len(opts.Paths) > 0 {
+		args = append(append(args, "--"), opts.Paths...)
+	}
+	cmd, _, _ := r.r.Git("archive", args...)
+	cmd.Stdout = w
+	return run(cmd)
+}
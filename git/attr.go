@@ -0,0 +1,42 @@
+package git
+
+import (
+	"strings"
+)
+
+// CheckAttr looks up the gitattributes of paths.  If attrs is empty,
+// every attribute that is set on each path is returned.
+// The result maps each path to its attributes, and each attribute to
+// its value, which is "set" or "unset" for attributes that are just
+// turned on or off, like "diff" or "-diff".
+// Attributes that are not specified for a path are left out.
+func (r *Repo) CheckAttr(attrs []string, paths []string) (res map[string]map[string]string, err error) {
+	args := []string{"--stdin", "-z"}
+	if len(attrs) == 0 {
+		args = append(args, "--all")
+	} else {
+		args = append(args, attrs...)
+	}
+	input := strings.Join(paths, "\x00") + "\x00"
+	cmd, out, _ := r.GitWithInput(strings.NewReader(input), "check-attr", args...)
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	res = make(map[string]map[string]string, len(paths))
+	for _, path := range paths {
+		res[path] = make(map[string]string)
+	}
+	// <path> NUL <attribute> NUL <info> NUL
+	fields := strings.Split(out.String(), "\x00")
+	for i := 0; i+2 < len(fields); i += 3 {
+		path, attr, info := fields[i], fields[i+1], fields[i+2]
+		if info == "unspecified" {
+			continue
+		}
+		if res[path] == nil {
+			res[path] = make(map[string]string)
+		}
+		res[path][attr] = info
+	}
+	return res, nil
+}
@@ -0,0 +1,78 @@
+package git
+
+import "os/exec"
+
+// Auth controls how git authenticates to remotes.
+// The zero value keeps git from prompting for anything on the
+// terminal, so that network operations fail instead of hanging.
+type Auth struct {
+	// SSHCommand is run instead of ssh, as GIT_SSH_COMMAND.
+	// Use it to pick a deploy key, e.g. "ssh -i key -o IdentitiesOnly=yes".
+	SSHCommand string
+	// AskPass is the program git runs to ask for usernames and
+	// passwords, as GIT_ASKPASS.
+	AskPass string
+	// CredentialHelper replaces any configured credential helpers.
+	CredentialHelper string
+	// Credentials, if not nil, is asked for the username and password
+	// when cloning, fetching, or pushing over HTTP(S), instead of any
+	// credential helpers.  It is passed a Credential with the protocol,
+	// host, and path of the remote filled in.  Commands it is not asked
+	// about still use CredentialHelper.
+	Credentials func(c Credential) (Credential, error)
+	// Interactive lets git prompt for credentials on the terminal.
+	Interactive bool
+}
+
+func (a Auth) env() []string {
+	env := []string{}
+	if a.SSHCommand != "" {
+		env = append(env, "GIT_SSH_COMMAND="+a.SSHCommand)
+	}
+	if a.AskPass != "" {
+		env = append(env, "GIT_ASKPASS="+a.AskPass)
+	}
+	if !a.Interactive {
+		env = append(env, "GIT_TERMINAL_PROMPT=0")
+	}
+	return env
+}
+
+func (a Auth) args() []string {
+	if a.CredentialHelper == "" {
+		return nil
+	}
+	// The empty value clears the list of helpers git already has.
+	return []string{"-c", "credential.helper=", "-c", "credential.helper=" + a.CredentialHelper}
+}
+
+// apply makes cmd, which must have been made by Git, authenticate with a.
+func (a Auth) apply(cmd *exec.Cmd) {
+	cmd.Env = append(cmd.Env, a.env()...)
+	if args := a.args(); len(args) > 0 {
+		cmd.Args = append(append([]string{cmd.Args[0]}, args...), cmd.Args[1:]...)
+	}
+}
+
+// overrideConfig adds -c settings to cmd, which must have been made
+// by Git, after any it already has, so that they win.
+func overrideConfig(cmd *exec.Cmd, settings ...string) {
+	i := 1
+	for i+1 < len(cmd.Args) && cmd.Args[i] == "-c" {
+		i += 2
+	}
+	args := make([]string, 0, len(cmd.Args)+2*len(settings))
+	args = append(args, cmd.Args[:i]...)
+	for _, setting := range settings {
+		args = append(args, "-c", setting)
+	}
+	cmd.Args = append(args, cmd.Args[i:]...)
+}
+
+// authOr returns *auth, or def if auth is nil.
+func authOr(auth *Auth, def Auth) Auth {
+	if auth == nil {
+		return def
+	}
+	return *auth
+}
@@ -0,0 +1,122 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Bisect is a bisect session, used to find the commit
+// that introduced a change by binary search.
+type Bisect struct {
+	// Culprit is the first bad commit, once the search has found it.
+	Culprit *Ref
+	r       *Repo
+}
+
+// ErrBisectSkip can be returned by the test passed to Bisect.Run
+// to skip a commit that cannot be tested.
+var ErrBisectSkip = errors.New("Skip this commit")
+
+// BisectStart starts searching for the commit between good and bad
+// that made bad go bad, and checks out the first commit to test.
+func (r *Repo) BisectStart(bad, good *Ref) (res *Bisect, err error) {
+	res = &Bisect{r: r}
+	cmd, out, _ := r.Git("bisect", "start", bad.SHA, good.SHA, "--")
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	res.parse(out.String())
+	return res, nil
+}
+
+// parse looks for the verdict that git bisect prints once it
+// has narrowed things down to a single commit.
+func (b *Bisect) parse(out string) {
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasSuffix(line, " is the first bad commit") {
+			sha := strings.Fields(line)[0]
+			b.Culprit = &Ref{Path: sha, SHA: sha, r: b.r}
+			return
+		}
+	}
+}
+
+func (b *Bisect) mark(how string) (culprit *Ref, err error) {
+	if b.Culprit != nil {
+		return b.Culprit, nil
+	}
+	cmd, out, _ := b.r.Git("bisect", how)
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	b.parse(out.String())
+	return b.Culprit, nil
+}
+
+// Current returns a raw Ref for the commit that is checked out for testing.
+func (b *Bisect) Current() (res *Ref, err error) {
+	cmd, out, _ := b.r.Git("rev-parse", "HEAD")
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	sha := strings.TrimSpace(out.String())
+	return &Ref{Path: sha, SHA: sha, r: b.r}, nil
+}
+
+// MarkGood marks the commit being tested as good.  It returns the
+// culprit if that was enough to find it, and nil otherwise.
+func (b *Bisect) MarkGood() (culprit *Ref, err error) {
+	return b.mark("good")
+}
+
+// MarkBad marks the commit being tested as bad.  It returns the
+// culprit if that was enough to find it, and nil otherwise.
+func (b *Bisect) MarkBad() (culprit *Ref, err error) {
+	return b.mark("bad")
+}
+
+// Skip skips the commit being tested.  It returns the
+// culprit if that was enough to find it, and nil otherwise.
+func (b *Bisect) Skip() (culprit *Ref, err error) {
+	return b.mark("skip")
+}
+
+// Reset ends the bisect session and checks out whatever
+// was checked out before it started.
+func (b *Bisect) Reset() (err error) {
+	cmd, _, _ := b.r.Git("bisect", "reset")
+	if err = run(cmd); err != nil {
+		return err
+	}
+	b.r.ReloadRefs()
+	return nil
+}
+
+// Run drives the whole search, calling test on each commit that needs testing.
+// test should return true if the commit is good, false if it is bad, and
+// ErrBisectSkip if it cannot be tested.  Any other error stops the search.
+// Run does not reset the session, so call Reset once done with it.
+func (b *Bisect) Run(test func(*Ref) (bool, error)) (culprit *Ref, err error) {
+	for b.Culprit == nil {
+		ref, err := b.Current()
+		if err != nil {
+			return nil, err
+		}
+		good, err := test(ref)
+		switch {
+		case err == ErrBisectSkip:
+			_, err = b.Skip()
+		case err != nil:
+			return nil, fmt.Errorf("Bisect stopped testing %s: %v", ref.SHA, err)
+		case good:
+			_, err = b.MarkGood()
+		default:
+			_, err = b.MarkBad()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b.Culprit, nil
+}
@@ -0,0 +1,122 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// BlameLine is a single line of a blamed file.
+type BlameLine struct {
+	// OrigLine is the line number in the commit that introduced the line,
+	// and FinalLine is the line number in the blamed file.
+	OrigLine, FinalLine int
+	Content             string
+}
+
+// BlameHunk is a run of consecutive lines that came from the same commit.
+type BlameHunk struct {
+	SHA     string
+	Author  Signature
+	Summary string
+	// OrigPath is the path of the file in the commit that introduced the lines.
+	OrigPath string
+	Lines    []BlameLine
+}
+
+// blameCommit holds the information that git blame --porcelain
+// only emits the first time it sees a commit.
+type blameCommit struct {
+	author            Signature
+	summary, origPath string
+}
+
+// Blame figures out which commit last touched each line of path as of ref.
+// If ref is nil, the file in the working tree is blamed.
+func (r *Repo) Blame(ref *Ref, path string) (res []*BlameHunk, err error) {
+	args := []string{"--porcelain"}
+	if ref != nil {
+		args = append(args, ref.SHA)
+	}
+	cmd, out, _ := r.Git("blame", append(args, "--", path)...)
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	commits := make(map[string]*blameCommit)
+	hunkCommits := make([]*blameCommit, 0, 10)
+	res = make([]*BlameHunk, 0, 10)
+	var hunk *BlameHunk
+	var current *blameCommit
+	var line BlameLine
+	scanner := bufio.NewScanner(out)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if strings.HasPrefix(text, "\t") {
+			if hunk == nil {
+				return nil, fmt.Errorf("Cannot parse blame line %q", text)
+			}
+			line.Content = text[1:]
+			hunk.Lines = append(hunk.Lines, line)
+			continue
+		}
+		parts := strings.SplitN(text, " ", 2)
+		if isSHA(parts[0]) {
+			// <sha> <orig line> <final line> [<lines in group>]
+			fields := strings.Fields(text)
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("Cannot parse blame header %q", text)
+			}
+			line = BlameLine{OrigLine: atoiDefault(fields[1], 0), FinalLine: atoiDefault(fields[2], 0)}
+			if current = commits[fields[0]]; current == nil {
+				current = new(blameCommit)
+				commits[fields[0]] = current
+			}
+			if len(fields) == 4 || hunk == nil {
+				hunk = &BlameHunk{SHA: fields[0]}
+				res = append(res, hunk)
+				hunkCommits = append(hunkCommits, current)
+			}
+			continue
+		}
+		if current == nil || len(parts) != 2 {
+			continue
+		}
+		switch parts[0] {
+		case "author":
+			current.author.Name = parts[1]
+		case "author-mail":
+			current.author.Email = strings.Trim(parts[1], "<>")
+		case "author-time":
+			current.author.When = parseTime(parts[1])
+		case "summary":
+			current.summary = parts[1]
+		case "filename":
+			current.origPath = parts[1]
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	// Commit information only shows up the first time git sees a
+	// commit, so fill in the hunks once we have seen everything.
+	for i, hunk := range res {
+		hunk.Author = hunkCommits[i].author
+		hunk.Summary = hunkCommits[i].summary
+		hunk.OrigPath = hunkCommits[i].origPath
+	}
+	return res, nil
+}
+
+// isSHA tests to see if s looks like a full SHA1 or SHA256 object name.
+func isSHA(s string) bool {
+	if len(s) != 40 && len(s) != 64 {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,40 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRefreshStaleInterval(t *testing.T) {
+	src := newRepo(t)
+	sh(t, src, "commit", "-qm", "a", "--allow-empty")
+	for _, tc := range []struct {
+		interval time.Duration
+		fetched  bool
+	}{
+		{0, false},
+		{time.Hour, true},
+	} {
+		c, err := NewCloneCache(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		mirror, err := c.Mirror(src.WorkDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		old := time.Now().Add(-24 * time.Hour)
+		if err := os.Chtimes(filepath.Join(mirror.GitDir, cacheFetchedStamp), old, old); err != nil {
+			t.Fatal(err)
+		}
+		c.RefreshInterval = tc.interval
+		if err := c.RefreshStale(); err != nil {
+			t.Fatal(err)
+		}
+		if fetched := stampTime(mirror, cacheFetchedStamp).After(old.Add(time.Minute)); fetched != tc.fetched {
+			t.Errorf("RefreshInterval %v: fetched = %v, want %v", tc.interval, fetched, tc.fetched)
+		}
+	}
+}
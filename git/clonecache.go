@@ -0,0 +1,250 @@
+package git
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CloneCache keeps bare mirror clones of remote repositories under Root,
+// and makes new clones borrow objects from them so that cloning the same
+// repository over and over only transfers what changed.
+type CloneCache struct {
+	// Root is the directory that the mirrors live in.
+	Root string
+	// RefreshInterval is how old a mirror can get before it is fetched
+	// again.  If it is 0, mirrors are only fetched when they are created.
+	RefreshInterval time.Duration
+	// MaxSize is how many bytes the mirrors may take up in total before
+	// Evict starts removing the least recently used ones.
+	// If it is 0, the cache can grow without limit.
+	MaxSize int64
+	// Shared clones straight from the mirror with --shared instead of
+	// cloning from the remote with --reference.  It is faster, but
+	// the clone's objects only ever come from the mirror.
+	Shared bool
+	// Dissociate makes clones copy the objects they borrowed, so that
+	// they keep working if their mirror is evicted.
+	Dissociate bool
+	mu         sync.Mutex
+}
+
+// These files in a mirror's git directory record when
+// it was last fetched and last used.
+const (
+	cacheFetchedStamp = "clonecache-fetched"
+	cacheUsedStamp    = "clonecache-used"
+)
+
+// NewCloneCache makes a CloneCache that keeps its mirrors in root.
+func NewCloneCache(root string) (res *CloneCache, err error) {
+	if err = os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &CloneCache{Root: root}, nil
+}
+
+func stamp(r *Repo, name string) (err error) {
+	return ioutil.WriteFile(filepath.Join(r.GitDir, name), []byte(time.Now().UTC().Format(time.RFC3339)), 0644)
+}
+
+func stampTime(r *Repo, name string) time.Time {
+	fi, err := os.Stat(filepath.Join(r.GitDir, name))
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+// mirrorPath works out where the mirror of url lives.  The hash keeps
+// different URLs apart, and the base name keeps the cache readable.
+func (c *CloneCache) mirrorPath(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	base := strings.TrimSuffix(path.Base(strings.TrimRight(url, "/")), ".git")
+	base = strings.Map(func(r rune) rune {
+		if r == '/' || r == ':' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, base)
+	return filepath.Join(c.Root, hex.EncodeToString(sum[:8])+"-"+base+".git")
+}
+
+func (c *CloneCache) refresh(mirror *Repo) (err error) {
+	cmd, _, _ := mirror.Git("fetch", "-q", "--prune", "origin")
+	if err = run(cmd); err != nil {
+		return err
+	}
+	mirror.ReloadRefs()
+	return stamp(mirror, cacheFetchedStamp)
+}
+
+// Mirror returns the mirror of url, creating it if it does not exist yet,
+// and refreshing it if it is older than RefreshInterval.
+func (c *CloneCache) Mirror(url string) (res *Repo, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dir := c.mirrorPath(url)
+	if _, err = os.Stat(dir); os.IsNotExist(err) {
+		if res, err = Clone(url, dir, "--mirror", "-q"); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+		if err = stamp(res, cacheFetchedStamp); err != nil {
+			return nil, err
+		}
+	} else {
+		if res, err = Open(dir); err != nil {
+			return nil, err
+		}
+		if c.RefreshInterval > 0 && time.Since(stampTime(res, cacheFetchedStamp)) > c.RefreshInterval {
+			if err = c.refresh(res); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return res, stamp(res, cacheUsedStamp)
+}
+
+// Clone clones url into target, borrowing objects from the mirror of url.
+// Any args are passed on to git clone.  The clone's origin points at url,
+// not at the mirror.
+func (c *CloneCache) Clone(url, target string, args ...string) (res *Repo, err error) {
+	mirror, err := c.Mirror(url)
+	if err != nil {
+		return nil, err
+	}
+	if c.Dissociate {
+		args = append(args, "--dissociate")
+	}
+	if !c.Shared {
+		return Clone(url, target, append(args, "--reference", mirror.GitDir)...)
+	}
+	if res, err = Clone(mirror.GitDir, target, append(args, "--shared")...); err != nil {
+		return nil, err
+	}
+	if err = res.SetRemoteURL("origin", url); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Mirrors returns all the mirrors in the cache.
+func (c *CloneCache) Mirrors() (res []*Repo, err error) {
+	entries, err := ioutil.ReadDir(c.Root)
+	if err != nil {
+		return nil, err
+	}
+	res = make([]*Repo, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasSuffix(entry.Name(), ".git") {
+			continue
+		}
+		if mirror, err := Open(filepath.Join(c.Root, entry.Name())); err == nil {
+			res = append(res, mirror)
+		}
+	}
+	return res, nil
+}
+
+// RefreshStale fetches every mirror that is older than RefreshInterval.
+// It does nothing if RefreshInterval is 0.
+// It keeps going if a mirror fails to refresh, and returns the last error.
+func (c *CloneCache) RefreshStale() (err error) {
+	if c.RefreshInterval <= 0 {
+		return nil
+	}
+	mirrors, err := c.Mirrors()
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, mirror := range mirrors {
+		if time.Since(stampTime(mirror, cacheFetchedStamp)) <= c.RefreshInterval {
+			continue
+		}
+		if refreshErr := c.refresh(mirror); refreshErr != nil {
+			err = refreshErr
+		}
+	}
+	return err
+}
+
+func dirSize(dir string) (size int64) {
+	filepath.Walk(dir, func(_ string, fi os.FileInfo, err error) error {
+		if err == nil && !fi.IsDir() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// Evict removes the least recently used mirrors until the cache fits
+// in MaxSize, and returns the paths of the mirrors it removed.
+// Clones that borrowed objects from an evicted mirror without
+// Dissociate will be broken.
+func (c *CloneCache) Evict() (evicted []string, err error) {
+	if c.MaxSize <= 0 {
+		return nil, nil
+	}
+	mirrors, err := c.Mirrors()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sort.Slice(mirrors, func(i, j int) bool {
+		return stampTime(mirrors[i], cacheUsedStamp).Before(stampTime(mirrors[j], cacheUsedStamp))
+	})
+	sizes := make([]int64, len(mirrors))
+	var total int64
+	for i, mirror := range mirrors {
+		sizes[i] = dirSize(mirror.GitDir)
+		total += sizes[i]
+	}
+	for i := 0; i < len(mirrors) && total > c.MaxSize; i++ {
+		if err = os.RemoveAll(mirrors[i].GitDir); err != nil {
+			return evicted, err
+		}
+		evicted = append(evicted, mirrors[i].GitDir)
+		total -= sizes[i]
+	}
+	return evicted, nil
+}
+
+// Maintain refreshes stale mirrors and evicts old ones every interval,
+// until the returned stop function is called.  Errors are passed to
+// report, which may be nil.
+func (c *CloneCache) Maintain(interval time.Duration, report func(error)) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				err := c.RefreshStale()
+				if _, evictErr := c.Evict(); evictErr != nil {
+					err = evictErr
+				}
+				if err != nil && report != nil {
+					report(err)
+				}
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
@@ -0,0 +1,118 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// commitArgs accumulates the arguments and environment that
+// CommitOptions want to pass to git commit.
+type commitArgs struct {
+	args []string
+	env  []string
+}
+
+// CommitOption modifies how Commit invokes git commit.
+type CommitOption func(*commitArgs)
+
+// CommitAuthor overrides the author of the commit.
+func CommitAuthor(name, email string) CommitOption {
+	return func(c *commitArgs) {
+		c.args = append(c.args, fmt.Sprintf("--author=%s <%s>", name, email))
+	}
+}
+
+// CommitCommitter overrides the committer of the commit.
+func CommitCommitter(name, email string) CommitOption {
+	return func(c *commitArgs) {
+		c.env = append(c.env, "GIT_COMMITTER_NAME="+name, "GIT_COMMITTER_EMAIL="+email)
+	}
+}
+
+// CommitAllowEmpty allows creating a commit that has no changes.
+func CommitAllowEmpty() CommitOption {
+	return func(c *commitArgs) {
+		c.args = append(c.args, "--allow-empty")
+	}
+}
+
+// CommitAmend replaces the tip of the current branch instead of
+// creating a new commit on top of it.
+func CommitAmend() CommitOption {
+	return func(c *commitArgs) {
+		c.args = append(c.args, "--amend")
+	}
+}
+
+// CommitSignOff adds a Signed-off-by trailer to the commit message.
+func CommitSignOff() CommitOption {
+	return func(c *commitArgs) {
+		c.args = append(c.args, "--signoff")
+	}
+}
+
+// Commit commits whatever is in the index with the passed message.
+// It returns a raw Ref pointing at the new commit.
+func (r *Repo) Commit(msg string, opts ...CommitOption) (ref *Ref, err error) {
+	c := &commitArgs{args: []string{"-q", "-m", msg}}
+	for _, opt := range opts {
+		opt(c)
+	}
+	cmd, _, _ := r.Git("commit", c.args...)
+	if len(c.env) > 0 {
+		cmd.Env = append(cmd.Env, c.env...)
+	}
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	r.ReloadRefs()
+	cmd, out, _ := r.Git("rev-parse", "HEAD")
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	sha := strings.TrimSpace(out.String())
+	return &Ref{Path: sha, SHA: sha, r: r}, nil
+}
+
+// signatureEnv makes the environment variables that tell git
+// who role (AUTHOR or COMMITTER) is.
+func signatureEnv(role string, sig Signature) []string {
+	res := []string{"GIT_" + role + "_NAME=" + sig.Name, "GIT_" + role + "_EMAIL=" + sig.Email}
+	if !sig.When.IsZero() {
+		res = append(res, fmt.Sprintf("GIT_%s_DATE=%d %s", role, sig.When.Unix(), sig.When.Format("-0700")))
+	}
+	return res
+}
+
+// CommitTree creates a commit object for tree with the passed parents
+// and message, and returns a raw Ref pointing at it.  No ref is
+// updated, so the commit can be made in a bare repository and
+// then put on a branch with UpdateTo.
+// The first signature passed is used as the author, and the second
+// as the committer.  Otherwise they come from the git config.
+func (r *Repo) CommitTree(tree string, parents []string, msg string, author ...Signature) (ref *Ref, err error) {
+	args := []string{tree}
+	for _, parent := range parents {
+		args = append(args, "-p", parent)
+	}
+	cmd, out, _ := r.GitWithInput(strings.NewReader(msg), "commit-tree", args...)
+	for i, role := range []string{"AUTHOR", "COMMITTER"} {
+		if i < len(author) {
+			cmd.Env = append(cmd.Env, signatureEnv(role, author[i])...)
+		}
+	}
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	sha := strings.TrimSpace(out.String())
+	return &Ref{Path: sha, SHA: sha, r: r}, nil
+}
+
+// Commit returns the parsed commit object that this ref points at.
+func (r *Ref) Commit() (res *Commit, err error) {
+	cmd, out, _ := r.r.Git("log", "-1", "-z", "--format="+commitFormat, r.SHA, "--")
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	return parseCommit(strings.TrimSuffix(out.String(), "\x00"))
+}
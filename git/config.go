@@ -1,20 +1,29 @@
 package git
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
 	"strings"
-	"log"
+	"time"
 )
 
-func (r *Repo) readConfig() {
-	if r.cfg != nil {
-		return
+// readConfig returns the cached config, loading it if needed.
+// Like the cached refs, the ConfigMap is never changed once it is loaded.
+func (r *Repo) readConfig() (ConfigMap, error) {
+	r.mu.Lock()
+	cfg, gen := r.cfg, r.cfgGen
+	r.mu.Unlock()
+	if cfg != nil {
+		return cfg, nil
 	}
-	cmd,stdout,stderr := r.Git("config", "-l", "-z")
-	if err := cmd.Run(); err != nil {
-		log.Panic(stderr.String())
-		return
+	cmd,stdout,_ := r.Git("config", "-l", "-z")
+	if err := run(cmd); err != nil {
+		return nil, err
 	}
-	r.cfg = make(ConfigMap)
+	cfg = make(ConfigMap)
 	for _,line := range strings.Split(stdout.String(),"\x00") {
 		parts := strings.SplitN(line,"\n",2)
 		if len(parts) != 2 {
@@ -25,70 +34,419 @@ func (r *Repo) readConfig() {
 		if k == "" {
 			continue
 		}
-		r.cfg[k]=v
+		cfg[k]=v
 	}
-	return
+	// Like loadRefs, don't cache a config that was reloaded
+	// while we were reading it.
+	r.mu.Lock()
+	if r.cfgGen == gen {
+		r.cfg = cfg
+	}
+	r.mu.Unlock()
+	return cfg, nil
 }
 
 // ReloadConfig will force the config for this git repo to be lazily reloaded.
 func (r *Repo) ReloadConfig() {
+	r.mu.Lock()
 	r.cfg = nil
+	r.cfgGen++
+	r.mu.Unlock()
 }
 
 // Get a specific config value.
+// If the config cannot be read, nothing is found.
 func (r *Repo) Get(key string) (val string, found bool) {
-	r.readConfig()
-	val,found = r.cfg[key]
+	cfg,_ := r.readConfig()
+	val,found = cfg[key]
 	return
 }
 
-func (r *Repo) maybeKillSection(prefix string) {
+func (r *Repo) maybeKillSection(prefix string) (err error) {
 	if len(r.Find(prefix)) == 0 {
-		cmd, _, err := r.Git("config","--remove-section", prefix)
-		if cmd.Run() != nil {
-			log.Panic(err.String())
+		cmd, _, _ := r.Git("config","--remove-section", prefix)
+		// Newer versions of git remove the section themselves
+		// once the last variable in it is unset.
+		if err = run(cmd); err != nil && !gitErrorMatches(err, []string{"no such section"}) {
+			return err
 		}
 	}
+	return nil
 }
 
 // Unset a config variable.
-func (r *Repo) Unset(key string) {
-	r.readConfig()
+func (r *Repo) Unset(key string) (err error) {
 	if _,e := r.Get(key); e == true {
-		cmd, _, err := r.Git("config", "--unset-all",key)
-		delete(r.cfg,key)
-		if cmd.Run() == nil {
-			parts := strings.Split(key,".")
-			switch len(parts) {
-			case 0:  panic("Cannot happen!")
-			case 1:  r.maybeKillSection(key)
-			case 2:  r.maybeKillSection(parts[0])
-			default: r.maybeKillSection(strings.Join(parts[0:len(parts)-1],"."))
-			}
-		} else {
-			panic(err.String())
+		cmd, _, _ := r.Git("config", "--unset-all",key)
+		err = run(cmd)
+		r.ReloadConfig()
+		if err != nil {
+			return err
 		}
+		if i := strings.LastIndex(key,"."); i > 0 {
+			return r.maybeKillSection(key[:i])
+		}
+		return r.maybeKillSection(key)
 	}
+	return nil
 }
 
-// Set a config variable.
-func (r *Repo) Set(key,val string) {
-	r.Unset(key)
-	cmd, _, _ := r.Git("config","--add", key,val)
-	if err := cmd.Run(); err != nil {
-		panic("Cannot happen!")
+// Set a config variable.  Any values it already had are
+// replaced, use AddValue to add another value to a multi-valued variable.
+func (r *Repo) Set(key,val string) (err error) {
+	if err = r.Unset(key); err != nil {
+		return err
 	}
-	r.cfg[key]=val
+	cmd, _, _ := r.Git("config","--add", key,val)
+	err = run(cmd)
+	r.ReloadConfig()
+	return err
 }
 
 // Find all config variables with a specific prefix.
+// If the config cannot be read, nothing is found.
 func (r *Repo) Find(prefix string) (res map[string]string) {
-	r.readConfig()
 	res = make(map[string]string)
-	for k,v := range r.cfg {
+	cfg,_ := r.readConfig()
+	for k,v := range cfg {
 		if strings.HasPrefix(k,prefix) {
 			res[k]=v
 		}
 	}
 	return res
 }
+
+// getAll parses the output of git config --get-all.
+func getAll(cmd *exec.Cmd, out *bytes.Buffer) (res []string) {
+	res = []string{}
+	if cmd.Run() != nil {
+		return res
+	}
+	for _, val := range strings.Split(out.String(), "\x00") {
+		if val != "" {
+			res = append(res, val)
+		}
+	}
+	return res
+}
+
+// GetAll gets all the values of a multi-valued config variable,
+// like remote.origin.fetch, in the order git reads them.
+func (r *Repo) GetAll(key string) (vals []string) {
+	cmd, out, _ := r.Git("config", "-z", "--get-all", key)
+	return getAll(cmd, out)
+}
+
+// AddValue adds a value to a config variable without touching
+// any values it already has.
+func (r *Repo) AddValue(key, val string) (err error) {
+	cmd, _, _ := r.Git("config", "--add", key, val)
+	if err = run(cmd); err != nil {
+		return err
+	}
+	r.ReloadConfig()
+	return nil
+}
+
+// UnsetValue removes the values of a config variable that match
+// the regular expression pattern, and leaves the rest alone.
+// It is not an error if nothing matched.
+func (r *Repo) UnsetValue(key, pattern string) (err error) {
+	cmd, _, _ := r.Git("config", "--unset-all", key, pattern)
+	return unsetValue(r, cmd)
+}
+
+func unsetValue(r *Repo, cmd *exec.Cmd) (err error) {
+	err = run(cmd)
+	var gitErr *GitError
+	if errors.As(err, &gitErr) && gitErr.ExitCode == 5 {
+		// git config exits with 5 when there was nothing to unset.
+		err = nil
+	}
+	if r != nil {
+		r.ReloadConfig()
+	}
+	return err
+}
+
+// getTyped gets a config value, letting git canonicalize it as typ.
+// If typ is empty, the value is returned as it is.
+func (r *Repo) getTyped(key, typ string) (val string, found bool, err error) {
+	args := []string{"--get", key}
+	if typ != "" {
+		args = append([]string{"--type=" + typ}, args...)
+	}
+	cmd, out, _ := r.Git("config", args...)
+	if err = run(cmd); err != nil {
+		var gitErr *GitError
+		if errors.As(err, &gitErr) && gitErr.ExitCode == 1 {
+			// Not set at all.
+			return "", false, nil
+		}
+		return "", true, err
+	}
+	return strings.TrimSuffix(out.String(), "\n"), true, nil
+}
+
+// setTyped sets a config value, replacing any values it already has,
+// letting git canonicalize it as typ.
+func (r *Repo) setTyped(key, typ, val string) (err error) {
+	cmd, _, _ := r.Git("config", "--type="+typ, "--replace-all", key, val)
+	if err = run(cmd); err != nil {
+		return err
+	}
+	r.ReloadConfig()
+	return nil
+}
+
+// GetBool gets a config value as a bool, the way git reads them,
+// so "yes", "on", "true", and "1" are all true.
+// It returns an error if the value is not a bool.
+func (r *Repo) GetBool(key string) (val, found bool, err error) {
+	str, found, err := r.getTyped(key, "bool")
+	return str == "true", found, err
+}
+
+// GetInt gets a config value as an integer.  The suffixes k, m, and g
+// multiply the value by 1024, 1024^2, and 1024^3, as they do for git.
+func (r *Repo) GetInt(key string) (val int64, found bool, err error) {
+	str, found, err := r.getTyped(key, "int")
+	if err != nil || !found {
+		return 0, found, err
+	}
+	val, err = strconv.ParseInt(str, 10, 64)
+	return val, found, err
+}
+
+// GetPath gets a config value as a path, with a leading ~ expanded
+// to the user's home directory.
+func (r *Repo) GetPath(key string) (val string, found bool, err error) {
+	return r.getTyped(key, "path")
+}
+
+// GetDuration gets a config value as a duration.  Values can be Go
+// durations like "90m", or approxidates like "2.weeks.ago", which is
+// how git spells durations in settings like gc.pruneExpire.
+func (r *Repo) GetDuration(key string) (val time.Duration, found bool, err error) {
+	// Not r.Get, since the cached config has the variable
+	// names lowercased.
+	str, found, err := r.getTyped(key, "")
+	if err != nil || !found {
+		return 0, found, err
+	}
+	if val, err = time.ParseDuration(str); err == nil {
+		return val, true, nil
+	}
+	str, found, err = r.getTyped(key, "expiry-date")
+	if err != nil || !found {
+		return 0, found, err
+	}
+	when, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return 0, true, err
+	}
+	return time.Since(time.Unix(when, 0)).Round(time.Second), true, nil
+}
+
+// SetBool sets a config value to a bool.
+func (r *Repo) SetBool(key string, val bool) (err error) {
+	return r.setTyped(key, "bool", strconv.FormatBool(val))
+}
+
+// SetInt sets a config value to an integer.
+func (r *Repo) SetInt(key string, val int64) (err error) {
+	return r.setTyped(key, "int", strconv.FormatInt(val, 10))
+}
+
+// SetPath sets a config value to a path.
+func (r *Repo) SetPath(key, val string) (err error) {
+	return r.setTyped(key, "path", val)
+}
+
+// SetDuration sets a config value to a duration, as an approxidate
+// that git can read, like "3600.seconds.ago".
+func (r *Repo) SetDuration(key string, val time.Duration) (err error) {
+	return r.setTyped(key, "expiry-date", fmt.Sprintf("%d.seconds.ago", int64(val.Seconds())))
+}
+
+// Scope names a config file that git reads settings from.
+type Scope string
+
+const (
+	// LocalScope is the repository's own config file.
+	LocalScope Scope = "--local"
+	// WorktreeScope is the config file for the current worktree.
+	WorktreeScope Scope = "--worktree"
+	// GlobalScope is the user's ~/.gitconfig.
+	GlobalScope Scope = "--global"
+	// SystemScope is the system-wide config file.
+	SystemScope Scope = "--system"
+)
+
+// FileScope makes a Scope for the config file at path.
+func FileScope(path string) Scope {
+	return Scope("--file=" + path)
+}
+
+// Config reads and writes the settings in a single config file,
+// unlike the Repo config methods, which read the settings from
+// every file git looks at and write to the local one.
+type Config struct {
+	scope Scope
+	r     *Repo
+}
+
+// ConfigScope returns a Config for one of the config files
+// that this repository uses.
+func (r *Repo) ConfigScope(scope Scope) *Config {
+	return &Config{scope: scope, r: r}
+}
+
+// GlobalConfig returns a Config for the user's global config file.
+func GlobalConfig() *Config {
+	return &Config{scope: GlobalScope}
+}
+
+// SystemConfig returns a Config for the system-wide config file.
+func SystemConfig() *Config {
+	return &Config{scope: SystemScope}
+}
+
+// FileConfig returns a Config for the config file at path.
+func FileConfig(path string) *Config {
+	return &Config{scope: FileScope(path)}
+}
+
+func (c *Config) git(args ...string) (cmd *exec.Cmd, out *bytes.Buffer) {
+	args = append([]string{string(c.scope)}, args...)
+	if c.r != nil {
+		cmd, out, _ = c.r.Git("config", args...)
+	} else {
+		cmd, out, _ = Git("config", args...)
+	}
+	return cmd, out
+}
+
+// changed runs cmd, which changes the config, and makes sure the
+// repository will reread its config.
+func (c *Config) changed(cmd *exec.Cmd) (err error) {
+	if err = run(cmd); err != nil {
+		return err
+	}
+	if c.r != nil {
+		c.r.ReloadConfig()
+	}
+	return nil
+}
+
+// Get gets a config value.  If key has more than one value,
+// the last one wins, just like it does for git.
+func (c *Config) Get(key string) (val string, found bool) {
+	cmd, out := c.git("--get", key)
+	if cmd.Run() != nil {
+		return "", false
+	}
+	return strings.TrimSuffix(out.String(), "\n"), true
+}
+
+// Set sets a config value, replacing any values it already has.
+func (c *Config) Set(key, val string) (err error) {
+	cmd, _ := c.git("--replace-all", key, val)
+	return c.changed(cmd)
+}
+
+// GetAll gets all the values of a multi-valued config variable.
+func (c *Config) GetAll(key string) (vals []string) {
+	return getAll(c.git("-z", "--get-all", key))
+}
+
+// AddValue adds a value to a config variable without touching
+// any values it already has.
+func (c *Config) AddValue(key, val string) (err error) {
+	cmd, _ := c.git("--add", key, val)
+	return c.changed(cmd)
+}
+
+// Unset removes all the values of a config variable.
+// It is not an error if the variable was not set.
+func (c *Config) Unset(key string) (err error) {
+	cmd, _ := c.git("--unset-all", key)
+	return unsetValue(c.r, cmd)
+}
+
+// UnsetValue removes the values of a config variable that match
+// the regular expression pattern, and leaves the rest alone.
+func (c *Config) UnsetValue(key, pattern string) (err error) {
+	cmd, _ := c.git("--unset-all", key, pattern)
+	return unsetValue(c.r, cmd)
+}
+
+// Find gets all the config variables with a specific prefix.
+func (c *Config) Find(prefix string) (res map[string]string, err error) {
+	cmd, out := c.git("--list", "-z")
+	if err = run(cmd); err != nil {
+		var gitErr *GitError
+		if errors.As(err, &gitErr) && strings.Contains(gitErr.Stderr, "No such file or directory") {
+			// The config file does not exist yet.
+			return map[string]string{}, nil
+		}
+		return nil, err
+	}
+	res = make(map[string]string)
+	for _, entry := range strings.Split(out.String(), "\x00") {
+		parts := strings.SplitN(entry, "\n", 2)
+		if len(parts) == 2 && strings.HasPrefix(parts[0], prefix) {
+			res[parts[0]] = parts[1]
+		}
+	}
+	return res, nil
+}
+
+// GetGlobal gets a config value from the user's global git config.
+func GetGlobal(key string) (val string, found bool) {
+	return GlobalConfig().Get(key)
+}
+
+// SetGlobal sets a config value in the user's global git config,
+// replacing any values it already has.
+func SetGlobal(key, val string) (err error) {
+	return GlobalConfig().Set(key, val)
+}
+
+// bootstrapDefaults are the global settings that Bootstrap
+// makes sure exist unless told otherwise.
+var bootstrapDefaults = map[string]string{
+	"init.defaultBranch": "main",
+	"pull.rebase":        "false",
+}
+
+// Bootstrap prepares a usable global git config for environments
+// (such as containers) where there is no ~/.gitconfig.
+// It sets user.name and user.email from identity, along with
+// init.defaultBranch, pull.rebase, and anything in defaults.
+// Values in defaults override the built-in ones.
+// Settings that already exist in the global config are left alone.
+func Bootstrap(identity Signature, defaults map[string]string) (err error) {
+	want := make(map[string]string)
+	for k, v := range bootstrapDefaults {
+		want[k] = v
+	}
+	for k, v := range defaults {
+		want[k] = v
+	}
+	if identity.Name != "" {
+		want["user.name"] = identity.Name
+	}
+	if identity.Email != "" {
+		want["user.email"] = identity.Email
+	}
+	for k, v := range want {
+		if _, found := GetGlobal(k); found {
+			continue
+		}
+		if err = SetGlobal(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
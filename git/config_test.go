@@ -0,0 +1,31 @@
+package git
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetDuration(t *testing.T) {
+	r := newRepo(t)
+	for _, tc := range []struct {
+		key, val string
+		want     time.Duration
+	}{
+		{"gc.pruneExpire", "90m", 90 * time.Minute},
+		{"gc.reflogExpire", "2.weeks.ago", 14 * 24 * time.Hour},
+		{"test.lower", "30s", 30 * time.Second},
+	} {
+		sh(t, r, "config", tc.key, tc.val)
+		got, found, err := r.GetDuration(tc.key)
+		if err != nil || !found {
+			t.Fatalf("%s: found %v, err %v", tc.key, found, err)
+		}
+		// Approxidates are relative to now, so allow some slack.
+		if diff := got - tc.want; diff < -time.Minute || diff > time.Minute {
+			t.Errorf("%s = %q: got %v, want %v", tc.key, tc.val, got, tc.want)
+		}
+	}
+	if _, found, err := r.GetDuration("gc.notSet"); found || err != nil {
+		t.Errorf("unset key: found %v, err %v", found, err)
+	}
+}
@@ -0,0 +1,144 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Conflict is a file that git could not merge by itself.
+type Conflict struct {
+	Path string
+	// Base, Ours, and Theirs are the contents of the file in the merge
+	// base, on our side, and on their side.  They are nil if the file
+	// does not exist on that side.  As with git, during a rebase
+	// "ours" is the branch being rebased onto.
+	Base, Ours, Theirs []byte
+}
+
+// ConflictResolver resolves conflicts for merges, rebases,
+// and cherry-picks, so they can carry on without a human.
+type ConflictResolver interface {
+	// Resolve returns what the conflicted file should contain,
+	// or nil if it should be deleted.  Returning an error
+	// aborts the whole operation.
+	Resolve(c *Conflict) (resolved []byte, err error)
+}
+
+// ConflictResolverFunc lets an ordinary function be used as a ConflictResolver.
+type ConflictResolverFunc func(c *Conflict) ([]byte, error)
+
+// Resolve calls f(c).
+func (f ConflictResolverFunc) Resolve(c *Conflict) ([]byte, error) {
+	return f(c)
+}
+
+// blob gets the contents of a blob.
+func (r *Repo) blob(sha string) (res []byte, err error) {
+	cmd, out, _ := r.Git("cat-file", "blob", sha)
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Conflicts returns the files that have unresolved conflicts in the index.
+func (r *Repo) Conflicts() (res []*Conflict, err error) {
+	entries, err := r.LsFiles(LsFilesOptions{Unmerged: true})
+	if err != nil {
+		return nil, err
+	}
+	res = make([]*Conflict, 0)
+	byPath := make(map[string]*Conflict)
+	for _, entry := range entries {
+		c := byPath[entry.Path]
+		if c == nil {
+			c = &Conflict{Path: entry.Path}
+			byPath[c.Path] = c
+			res = append(res, c)
+		}
+		content, err := r.blob(entry.SHA)
+		if err != nil {
+			return nil, err
+		}
+		switch entry.Stage {
+		case 1:
+			c.Base = content
+		case 2:
+			c.Ours = content
+		case 3:
+			c.Theirs = content
+		}
+	}
+	return res, nil
+}
+
+// resolveConflicts runs resolver over the conflicts that made op fail with
+// err, and carries op on until it finishes.  If op failed for some other
+// reason than conflicts, or resolver gives up, it returns an error and
+// leaves it to the caller to abort op.
+func (r *Repo) resolveConflicts(op string, resolver ConflictResolver, err error) error {
+	for {
+		conflicts, listErr := r.Conflicts()
+		if listErr != nil {
+			return listErr
+		}
+		if len(conflicts) == 0 {
+			return err
+		}
+		for _, c := range conflicts {
+			resolved, err := resolver.Resolve(c)
+			if err != nil {
+				return err
+			}
+			if resolved == nil {
+				if err = r.Remove(c.Path); err != nil {
+					return err
+				}
+				continue
+			}
+			target := filepath.Join(r.WorkDir, c.Path)
+			mode := os.FileMode(0644)
+			if fi, err := os.Stat(target); err == nil {
+				mode = fi.Mode()
+			}
+			if err = ioutil.WriteFile(target, resolved, mode); err != nil {
+				return err
+			}
+			if err = r.Add(c.Path); err != nil {
+				return err
+			}
+		}
+		var cmd *exec.Cmd
+		if op == "merge" {
+			cmd, _, _ = r.Git("commit", "-q", "--no-edit")
+		} else {
+			cmd, _, _ = r.Git(op, "--continue")
+		}
+		cmd.Env = append(cmd.Env, "GIT_EDITOR=true")
+		if err = run(cmd); err == nil {
+			r.ReloadRefs()
+			return nil
+		}
+	}
+}
+
+// CherryPick applies the change that commit made on top of the current
+// branch.  If resolver is not nil, it is called to resolve any conflicts.
+// If the cherry-pick fails, it is aborted, leaving the branch alone.
+func (r *Repo) CherryPick(commit *Ref, resolver ConflictResolver) (err error) {
+	cmd, _, _ := r.Git("cherry-pick", commit.SHA)
+	if err = run(cmd); err == nil {
+		r.ReloadRefs()
+		return nil
+	}
+	if resolver != nil {
+		if err = r.resolveConflicts("cherry-pick", resolver, err); err == nil {
+			return nil
+		}
+	}
+	cmd, _, _ = r.Git("cherry-pick", "--abort")
+	cmd.Run()
+	return err
+}
@@ -0,0 +1,144 @@
+package git
+
+import (
+	"bufio"
+	"net/url"
+	"os/exec"
+	"strings"
+)
+
+// Credential is what git and its credential helpers pass back and
+// forth to authenticate to a remote.
+type Credential struct {
+	Protocol, Host, Path string
+	Username, Password   string
+}
+
+func (c Credential) encode() string {
+	var buf strings.Builder
+	for _, kv := range [][2]string{
+		{"protocol", c.Protocol},
+		{"host", c.Host},
+		{"path", c.Path},
+		{"username", c.Username},
+		{"password", c.Password},
+	} {
+		if kv[1] != "" {
+			buf.WriteString(kv[0] + "=" + kv[1] + "\n")
+		}
+	}
+	buf.WriteString("\n")
+	return buf.String()
+}
+
+func parseCredential(out string) (res Credential) {
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch parts[0] {
+		case "protocol":
+			res.Protocol = parts[1]
+		case "host":
+			res.Host = parts[1]
+		case "path":
+			res.Path = parts[1]
+		case "username":
+			res.Username = parts[1]
+		case "password":
+			res.Password = parts[1]
+		}
+	}
+	return res
+}
+
+// credentialForURL returns a Credential with the protocol, host,
+// and path of rawurl filled in.  Local paths and scp-style
+// ssh addresses have no host.
+func credentialForURL(rawurl string) (res Credential) {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Host == "" {
+		return res
+	}
+	return Credential{
+		Protocol: u.Scheme,
+		Host:     u.Host,
+		Path:     strings.TrimPrefix(u.Path, "/"),
+		Username: u.User.Username(),
+	}
+}
+
+func (r *Repo) credential(action string, c Credential) (res Credential, err error) {
+	cmd, out, _ := r.GitWithInput(strings.NewReader(c.encode()), "credential", action)
+	if err = run(cmd); err != nil {
+		return res, err
+	}
+	return parseCredential(out.String()), nil
+}
+
+// Fill asks the configured credential helpers (and, if r.Auth allows
+// it, the user) for the username and password that go with c.
+func (r *Repo) Fill(c Credential) (res Credential, err error) {
+	return r.credential("fill", c)
+}
+
+// Approve tells the credential helpers that c worked,
+// so that they can store it.
+func (r *Repo) Approve(c Credential) (err error) {
+	_, err = r.credential("approve", c)
+	return err
+}
+
+// Reject tells the credential helpers that c did not work,
+// so that they can forget it.
+func (r *Repo) Reject(c Credential) (err error) {
+	_, err = r.credential("reject", c)
+	return err
+}
+
+// credentialHelper answers git's requests for credentials for the
+// host in GIT_GO_CREDENTIAL_HOST with the username and password from
+// the environment, so they never show up on a command line.
+const credentialHelper = `!f() { test "$1" = get || return 0; h=; ` +
+	`while read -r l; do case "$l" in host=*) h="${l#host=}";; esac; done; ` +
+	`test "$h" = "$GIT_GO_CREDENTIAL_HOST" || return 0; ` +
+	`printf 'username=%s\npassword=%s\n' "$GIT_GO_CREDENTIAL_USERNAME" "$GIT_GO_CREDENTIAL_PASSWORD"; }; f`
+
+// provideCredentials asks a.Credentials for the credentials for rawurl,
+// and hands them to cmd, which must have been made by Git.
+func (a Auth) provideCredentials(cmd *exec.Cmd, rawurl string) (err error) {
+	if a.Credentials == nil {
+		return nil
+	}
+	c := credentialForURL(rawurl)
+	if c.Host == "" {
+		return nil
+	}
+	if c, err = a.Credentials(c); err != nil {
+		return err
+	}
+	cmd.Env = append(cmd.Env,
+		"GIT_GO_CREDENTIAL_HOST="+c.Host,
+		"GIT_GO_CREDENTIAL_USERNAME="+c.Username,
+		"GIT_GO_CREDENTIAL_PASSWORD="+c.Password)
+	// These have to come after any credential.helper settings
+	// from a.CredentialHelper, or they would be cleared out.
+	overrideConfig(cmd, "credential.helper=", "credential.helper="+credentialHelper)
+	return nil
+}
+
+// remoteURL returns the URL git will use to talk to remote,
+// which can be the name of a remote or a URL.
+func (r *Repo) remoteURL(remote string, push bool) string {
+	args := []string{"get-url"}
+	if push {
+		args = append(args, "--push")
+	}
+	cmd, out, _ := r.Git("remote", append(args, remote)...)
+	if cmd.Run() != nil {
+		return remote
+	}
+	return strings.TrimSpace(out.String())
+}
@@ -0,0 +1,118 @@
+package git
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DescribeOptions controls how Describe names a commit.
+type DescribeOptions struct {
+	// Tags lets lightweight tags be used, not just annotated ones.
+	Tags bool
+	// Always falls back to the abbreviated SHA if no tag can be found.
+	Always bool
+	// Dirty marks the description if the working tree has changes.
+	// It only works on the commit that is checked out.
+	Dirty bool
+	// Match only uses tags that match one of these globs.
+	Match []string
+	// Abbrev is how many characters of the SHA to use.  0 lets git
+	// decide, and a negative value makes git print just the tag,
+	// leaving the distance and SHA out.
+	Abbrev int
+}
+
+func (o DescribeOptions) args() []string {
+	args := []string{}
+	if o.Tags {
+		args = append(args, "--tags")
+	}
+	if o.Always {
+		args = append(args, "--always")
+	}
+	if o.Dirty {
+		args = append(args, "--dirty")
+	}
+	for _, pattern := range o.Match {
+		args = append(args, "--match", pattern)
+	}
+	switch {
+	case o.Abbrev > 0:
+		args = append(args, "--abbrev="+strconv.Itoa(o.Abbrev))
+	case o.Abbrev < 0:
+		args = append(args, "--abbrev=0")
+	}
+	return args
+}
+
+// Description is a parsed git describe result.
+type Description struct {
+	// Tag is the nearest tag, and Distance is how many commits
+	// have been made since it.  Tag is empty if Always had to
+	// fall back to the SHA.
+	Tag      string
+	Distance int
+	// SHA is the abbreviated SHA of the commit, if git included it.
+	SHA string
+	// Dirty is true if the working tree has changes.
+	Dirty bool
+	// String is the description exactly as git printed it.
+	String string
+}
+
+var describeRE = regexp.MustCompile(`^(.+)-([0-9]+)-g([0-9a-f]+)$`)
+
+// Describe names this commit relative to the nearest tag, the way
+// build tools derive version strings.
+func (r *Ref) Describe(opts DescribeOptions) (res *Description, err error) {
+	args := opts.args()
+	if opts.Dirty {
+		// --dirty describes HEAD, so it had better be us.
+		head, err := r.r.CurrentRef()
+		if err != nil {
+			return nil, err
+		}
+		if head == nil || head.SHA != r.SHA {
+			return nil, fmt.Errorf("%s is not checked out, cannot tell if it is dirty.", r.Path)
+		}
+	} else {
+		args = append(args, r.SHA)
+	}
+	cmd, out, _ := r.r.Git("describe", args...)
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	res = &Description{String: strings.TrimSpace(out.String())}
+	desc := res.String
+	if opts.Dirty && strings.HasSuffix(desc, "-dirty") {
+		res.Dirty = true
+		desc = strings.TrimSuffix(desc, "-dirty")
+	}
+	if parts := describeRE.FindStringSubmatch(desc); parts != nil {
+		res.Tag, res.SHA = parts[1], parts[3]
+		res.Distance, _ = strconv.Atoi(parts[2])
+		return res, nil
+	}
+	if opts.Always && strings.HasPrefix(r.SHA, desc) {
+		if _, err := r.r.Ref("refs/tags/" + desc); err != nil {
+			res.SHA = desc
+			return res, nil
+		}
+	}
+	res.Tag = desc
+	return res, nil
+}
+
+// NameRev names this commit relative to the nearest ref that has it
+// in its history, like "tags/v1.0~3" or "master~2^2".  Unlike Describe,
+// it looks forward from the commit to the refs that contain it.
+// It returns an error if no ref contains the commit.
+func (r *Ref) NameRev() (name string, err error) {
+	cmd, out, _ := r.r.Git("name-rev", "--name-only", "--no-undefined", r.SHA)
+	if err = run(cmd); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out.String()), nil
+}
@@ -0,0 +1,289 @@
+package git
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DiffOptions controls what Diff and friends compare and how.
+type DiffOptions struct {
+	// Paths limits the diff to these paths.
+	Paths []string
+	// Context is the number of context lines around each change.
+	// If it is zero, git's default is used.
+	Context int
+	// DetectRenames turns on rename and copy detection.
+	DetectRenames bool
+	// IgnoreWhitespace ignores whitespace when comparing lines.
+	IgnoreWhitespace bool
+}
+
+// args builds the arguments for comparing a to b.
+// If b is nil, a is compared to the working tree.
+// If a is also nil, the index is compared to the working tree.
+func (o DiffOptions) args(a, b *Ref, extra ...string) []string {
+	args := append([]string{"--no-color", "--no-ext-diff"}, extra...)
+	if o.Context > 0 {
+		args = append(args, "-U"+strconv.Itoa(o.Context))
+	}
+	if o.DetectRenames {
+		args = append(args, "-M", "-C")
+	} else {
+		args = append(args, "--no-renames")
+	}
+	if o.IgnoreWhitespace {
+		args = append(args, "-w")
+	}
+	if a != nil {
+		args = append(args, a.SHA)
+		if b != nil {
+			args = append(args, b.SHA)
+		}
+	}
+	args = append(args, "--")
+	return append(args, o.Paths...)
+}
+
+// DiffLine is a single line in a Hunk.
+type DiffLine struct {
+	// Op is ' ' for context, '+' for an added line, and '-' for a removed line.
+	Op byte
+	// Content is the line without the Op and the trailing newline.
+	Content string
+	// OldLine and NewLine are the line numbers in the old and new file.
+	// OldLine is 0 for added lines, and NewLine is 0 for removed lines.
+	OldLine, NewLine int
+}
+
+// Hunk is a single @@ section of a unified diff.
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	// Section is the function or section heading git put after the @@.
+	Section string
+	Lines   []DiffLine
+}
+
+// FileDiff holds the changes made to a single file.
+type FileDiff struct {
+	// OldPath and NewPath are the paths before and after the change.
+	// OldPath is empty for new files, and NewPath is empty for deleted ones.
+	OldPath, NewPath string
+	// OldMode and NewMode are the file modes, if git reported them.
+	OldMode, NewMode string
+	// Status is 'A', 'D', 'M', 'R', or 'C' for added, deleted, modified,
+	// renamed, or copied files.
+	Status byte
+	// Score is the similarity percentage of a rename or copy.
+	Score int
+	// Binary is true if git decided the file was binary, in which case
+	// there are no Hunks.
+	Binary bool
+	Hunks  []*Hunk
+}
+
+var hunkRE = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@ ?(.*)$`)
+
+// diffPath strips the prefix off a path from a diff header, unquoting it if needed.
+func diffPath(p, prefix string) string {
+	if strings.HasPrefix(p, `"`) {
+		if unquoted, err := strconv.Unquote(p); err == nil {
+			p = unquoted
+		}
+	}
+	if p == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(p, prefix)
+}
+
+func atoiDefault(s string, def int) int {
+	if s == "" {
+		return def
+	}
+	v, _ := strconv.Atoi(s)
+	return v
+}
+
+func parseDiff(scanner *bufio.Scanner) (res []*FileDiff, err error) {
+	var file *FileDiff
+	var hunk *Hunk
+	var oldLine, newLine int
+	res = make([]*FileDiff, 0, 10)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			// Best guess at the paths, in case there are no ---/+++ lines.
+			names := line[len("diff --git "):]
+			half := names[:len(names)/2]
+			file = &FileDiff{
+				OldPath: diffPath(half, "a/"),
+				NewPath: diffPath(half, "a/"),
+				Status:  'M',
+			}
+			hunk = nil
+			res = append(res, file)
+		case file == nil:
+			return nil, fmt.Errorf("Cannot parse diff line %q", line)
+		case hunk != nil && len(line) > 0 && (line[0] == ' ' || line[0] == '+' || line[0] == '-'):
+			l := DiffLine{Op: line[0], Content: line[1:]}
+			switch l.Op {
+			case ' ':
+				l.OldLine, l.NewLine = oldLine, newLine
+				oldLine++
+				newLine++
+			case '+':
+				l.NewLine = newLine
+				newLine++
+			case '-':
+				l.OldLine = oldLine
+				oldLine++
+			}
+			hunk.Lines = append(hunk.Lines, l)
+		case hunk != nil && strings.HasPrefix(line, `\`):
+			// "\ No newline at end of file"
+		case strings.HasPrefix(line, "@@ "):
+			parts := hunkRE.FindStringSubmatch(line)
+			if parts == nil {
+				return nil, fmt.Errorf("Cannot parse hunk header %q", line)
+			}
+			hunk = &Hunk{
+				OldStart: atoiDefault(parts[1], 0),
+				OldLines: atoiDefault(parts[2], 1),
+				NewStart: atoiDefault(parts[3], 0),
+				NewLines: atoiDefault(parts[4], 1),
+				Section:  parts[5],
+			}
+			oldLine, newLine = hunk.OldStart, hunk.NewStart
+			file.Hunks = append(file.Hunks, hunk)
+		case strings.HasPrefix(line, "--- "):
+			file.OldPath = diffPath(line[4:], "a/")
+		case strings.HasPrefix(line, "+++ "):
+			file.NewPath = diffPath(line[4:], "b/")
+		case strings.HasPrefix(line, "new file mode "):
+			file.Status = 'A'
+			file.OldPath = ""
+			file.NewMode = line[len("new file mode "):]
+		case strings.HasPrefix(line, "deleted file mode "):
+			file.Status = 'D'
+			file.NewPath = ""
+			file.OldMode = line[len("deleted file mode "):]
+		case strings.HasPrefix(line, "old mode "):
+			file.OldMode = line[len("old mode "):]
+		case strings.HasPrefix(line, "new mode "):
+			file.NewMode = line[len("new mode "):]
+		case strings.HasPrefix(line, "similarity index "):
+			file.Score = atoiDefault(strings.TrimSuffix(line[len("similarity index "):], "%"), 0)
+		case strings.HasPrefix(line, "rename from "):
+			file.Status = 'R'
+			file.OldPath = diffPath(line[len("rename from "):], "")
+		case strings.HasPrefix(line, "rename to "):
+			file.NewPath = diffPath(line[len("rename to "):], "")
+		case strings.HasPrefix(line, "copy from "):
+			file.Status = 'C'
+			file.OldPath = diffPath(line[len("copy from "):], "")
+		case strings.HasPrefix(line, "copy to "):
+			file.NewPath = diffPath(line[len("copy to "):], "")
+		case strings.HasPrefix(line, "Binary files "):
+			file.Binary = true
+		}
+	}
+	return res, scanner.Err()
+}
+
+// Diff compares a to b, and returns the changes to each file.
+// If b is nil, a is compared to the working tree.
+// If a and b are both nil, the index is compared to the working tree.
+func (r *Repo) Diff(a, b *Ref, opts DiffOptions) (res []*FileDiff, err error) {
+	cmd, out, _ := r.Git("diff", opts.args(a, b, "--src-prefix=a/", "--dst-prefix=b/")...)
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(out)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	return parseDiff(scanner)
+}
+
+// NumStat holds the number of lines added and deleted in a single file.
+type NumStat struct {
+	// OldPath is the path before a rename or copy.  It is the
+	// same as Path for everything else.
+	OldPath, Path  string
+	Added, Deleted int
+	// Binary is true if git could not count lines because the file is binary.
+	Binary bool
+}
+
+// DiffNumstat compares a to b, and returns the number of lines
+// added and deleted in each file, as git diff --numstat does.
+// a and b are handled the same way Diff handles them.
+func (r *Repo) DiffNumstat(a, b *Ref, opts DiffOptions) (res []NumStat, err error) {
+	cmd, out, _ := r.Git("diff", opts.args(a, b, "--numstat", "-z")...)
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	res = make([]NumStat, 0, 10)
+	scanner := bufio.NewScanner(out)
+	scanner.Split(scanNUL)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "\t", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("Cannot parse numstat record %q", scanner.Text())
+		}
+		stat := NumStat{OldPath: parts[2], Path: parts[2]}
+		if parts[0] == "-" && parts[1] == "-" {
+			stat.Binary = true
+		} else {
+			stat.Added = atoiDefault(parts[0], 0)
+			stat.Deleted = atoiDefault(parts[1], 0)
+		}
+		if parts[2] == "" {
+			// Renames and copies are followed by the old and new paths.
+			if !scanner.Scan() {
+				return nil, errors.New("Truncated numstat output")
+			}
+			stat.OldPath = scanner.Text()
+			if !scanner.Scan() {
+				return nil, errors.New("Truncated numstat output")
+			}
+			stat.Path = scanner.Text()
+		}
+		res = append(res, stat)
+	}
+	return res, nil
+}
+
+// DiffStat summarizes a diff.
+type DiffStat struct {
+	Files, Insertions, Deletions int
+}
+
+var shortstatRE = regexp.MustCompile(`(\d+) (file|insertion|deletion)`)
+
+// DiffShortstat compares a to b and returns a summary of the changes,
+// as git diff --shortstat does.
+// a and b are handled the same way Diff handles them.
+func (r *Repo) DiffShortstat(a, b *Ref, opts DiffOptions) (res *DiffStat, err error) {
+	cmd, out, _ := r.Git("diff", opts.args(a, b, "--shortstat")...)
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	res = new(DiffStat)
+	for _, m := range shortstatRE.FindAllStringSubmatch(out.String(), -1) {
+		n := atoiDefault(m[1], 0)
+		switch m[2] {
+		case "file":
+			res.Files = n
+		case "insertion":
+			res.Insertions = n
+		case "deletion":
+			res.Deletions = n
+		}
+	}
+	return res, nil
+}
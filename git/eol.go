@@ -0,0 +1,57 @@
+package git
+
+// EOLOptions controls the line ending conversion and filters that
+// git applies when it writes files out of the repository, regardless
+// of what the user's config says.
+// Settings left empty fall back to whatever git is configured to do.
+type EOLOptions struct {
+	// AutoCRLF overrides core.autocrlf: "true", "false", or "input".
+	AutoCRLF string
+	// EOL overrides core.eol: "lf", "crlf", or "native".
+	EOL string
+	// SafeCRLF overrides core.safecrlf: "true", "false", or "warn".
+	SafeCRLF string
+	// DisableFilters names filter drivers (such as "lfs") whose
+	// smudge and clean commands are replaced with a plain copy.
+	DisableFilters []string
+}
+
+func (o EOLOptions) overrides() (res []string) {
+	if o.AutoCRLF != "" {
+		res = append(res, "core.autocrlf="+o.AutoCRLF)
+	}
+	if o.EOL != "" {
+		res = append(res, "core.eol="+o.EOL)
+	}
+	if o.SafeCRLF != "" {
+		res = append(res, "core.safecrlf="+o.SafeCRLF)
+	}
+	for _, name := range o.DisableFilters {
+		res = append(res,
+			"filter."+name+".smudge=cat",
+			"filter."+name+".clean=cat",
+			"filter."+name+".process=",
+			"filter."+name+".required=false")
+	}
+	return res
+}
+
+// RawEOL turns off all line ending conversion, so files are
+// written out of the repository byte for byte.
+var RawEOL = EOLOptions{AutoCRLF: "false", EOL: "lf", SafeCRLF: "false"}
+
+// WithEOL returns a Repo that operates on the same repository, but runs
+// every git command with opts applied.  Use it for one-off operations:
+//
+//	err := repo.WithEOL(git.RawEOL).Checkout("v1.0")
+func (r *Repo) WithEOL(opts EOLOptions) *Repo {
+	return &Repo{
+		GitDir:          r.GitDir,
+		WorkDir:         r.WorkDir,
+		NoAdvice:        r.NoAdvice,
+		Profile:         r.Profile,
+		Auth:            r.Auth,
+		AutoCommitGraph: r.AutoCommitGraph,
+		overrides:       append(append([]string{}, r.overrides...), opts.overrides()...),
+	}
+}
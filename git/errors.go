@@ -0,0 +1,308 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// GitError is returned when a git command fails.
+type GitError struct {
+	// Command is the git subcommand that failed, and Args are
+	// the arguments that were passed to it.
+	Command string
+	Args    []string
+	// ExitCode is the exit status of git, or -1 if git did not
+	// get far enough to exit normally.
+	ExitCode int
+	// Stdout and Stderr hold what git printed.
+	// Any hints git printed are split out of Stderr into Hints.
+	Stdout, Stderr string
+	Hints          []string
+	// Err is the error we got from os/exec.
+	Err error
+}
+
+func (e *GitError) Error() string {
+	msg := strings.TrimSpace(e.Stderr)
+	if msg == "" {
+		// Some commands (like commit) explain themselves on stdout.
+		msg = strings.TrimSpace(e.Stdout)
+	}
+	if msg == "" {
+		msg = e.Err.Error()
+	}
+	return fmt.Sprintf("git %s: %s", e.Command, msg)
+}
+
+// splitHints separates the "hint:" lines that git prints on stderr
+// from the rest of what it printed.
+func splitHints(stderr string) (msg string, hints []string) {
+	lines := strings.Split(stderr, "\n")
+	kept := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if strings.HasPrefix(line, "hint:") {
+			hints = append(hints, strings.TrimSpace(strings.TrimPrefix(line, "hint:")))
+		} else {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n"), hints
+}
+
+// newGitError makes a GitError out of a command made by Git that
+// failed with err.  It picks up whatever the command printed
+// from the buffers that Git attached to it.
+func newGitError(cmd *exec.Cmd, err error) *GitError {
+	res := &GitError{ExitCode: -1, Err: err}
+	// Skip the git binary and any -c options to find the subcommand.
+	args := cmd.Args[1:]
+	for len(args) > 1 && args[0] == "-c" {
+		args = args[2:]
+	}
+	if len(args) > 0 {
+		res.Command, res.Args = args[0], args[1:]
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		res.ExitCode = exitErr.ExitCode()
+	}
+	if buf, ok := cmd.Stdout.(*bytes.Buffer); ok {
+		res.Stdout = buf.String()
+	}
+	switch buf := cmd.Stderr.(type) {
+	case *bytes.Buffer:
+		res.Stderr, res.Hints = splitHints(buf.String())
+	case *progressWriter:
+		res.Stderr, res.Hints = splitHints(buf.String())
+	}
+	return res
+}
+
+// run runs a command made by Git, and turns any failure into a *GitError.
+func run(cmd *exec.Cmd) error {
+	if err := cmd.Run(); err != nil {
+		return newGitError(cmd, err)
+	}
+	return nil
+}
+
+// wait waits for a command made by Git that was started with Start,
+// and turns any failure into a *GitError.
+func wait(cmd *exec.Cmd) error {
+	if err := cmd.Wait(); err != nil {
+		return newGitError(cmd, err)
+	}
+	return nil
+}
+
+// runContext runs a command made by Git like run, but kills it
+// if ctx is done before it finishes, and returns the error from ctx.
+func runContext(ctx context.Context, cmd *exec.Cmd) error {
+	// Children of git (ssh, remote helpers) can hold its output
+	// open after it is killed, so don't wait on them for long.
+	cmd.WaitDelay = time.Second
+	if err := cmd.Start(); err != nil {
+		return newGitError(cmd, err)
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			cmd.Process.Kill()
+		case <-done:
+		}
+	}()
+	err := wait(cmd)
+	close(done)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// matches tests to see if the output of the command that failed
+// contains any of the patterns.
+func (e *GitError) matches(patterns []string) bool {
+	msg := strings.ToLower(e.Stderr + "\n" + e.Stdout)
+	for _, pattern := range patterns {
+		if strings.Contains(msg, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// gitErrorMatches tests to see if err is a GitError whose
+// output contains any of the patterns.
+func gitErrorMatches(err error, patterns []string) bool {
+	var gitErr *GitError
+	return errors.As(err, &gitErr) && gitErr.matches(patterns)
+}
+
+// Unwrap returns the error we got from os/exec.
+func (e *GitError) Unwrap() error {
+	return e.Err
+}
+
+// Is lets errors.Is test a GitError against the network failures
+// below, by looking at what git printed.
+func (e *GitError) Is(target error) bool {
+	patterns, ok := networkFailurePatterns[target]
+	return ok && e.matches(patterns)
+}
+
+// These are the reasons that talking to a remote can fail.
+// Test for them with errors.Is.
+var (
+	ErrAuthFailed          = errors.New("authentication failed")
+	ErrPermissionDenied    = errors.New("permission denied")
+	ErrRepoNotFound        = errors.New("repository not found")
+	ErrHostKeyVerification = errors.New("host key verification failed")
+)
+
+var networkFailurePatterns = map[error][]string{
+	ErrAuthFailed: {
+		"authentication failed",
+		"could not read username",
+		"could not read password",
+		"terminal prompts disabled",
+		"invalid username or password",
+		"the requested url returned error: 401",
+	},
+	ErrPermissionDenied: {
+		"permission denied",
+		"access denied",
+		"the requested url returned error: 403",
+	},
+	ErrRepoNotFound: {
+		"repository not found",
+		"does not appear to be a git repository",
+		"the requested url returned error: 404",
+	},
+	ErrHostKeyVerification: {
+		"host key verification failed",
+		"remote host identification has changed",
+		"no matching host key",
+	},
+}
+
+var notFoundPatterns = []string{
+	"not found",
+	"does not exist",
+	"unknown revision",
+	"bad revision",
+	"no such",
+	"did not match any",
+	"not a valid object name",
+	"couldn't find remote ref",
+	"could not find",
+	"invalid object name",
+	"needed a single revision",
+}
+
+var conflictPatterns = []string{
+	"conflict",
+	"needs merge",
+	"unmerged",
+	"would be overwritten",
+	"could not apply",
+}
+
+var authFailurePatterns = []string{
+	"authentication failed",
+	"permission denied",
+	"could not read username",
+	"could not read password",
+	"terminal prompts disabled",
+	"invalid username or password",
+	"the requested url returned error: 401",
+	"the requested url returned error: 403",
+	"host key verification failed",
+}
+
+// IsNotFound tests to see if err is a GitError caused by
+// something (a ref, a path, a remote, a repository) not existing.
+func IsNotFound(err error) bool {
+	return gitErrorMatches(err, notFoundPatterns)
+}
+
+// IsConflict tests to see if err is a GitError caused by
+// conflicting changes, from a merge, rebase, or checkout.
+func IsConflict(err error) bool {
+	return gitErrorMatches(err, conflictPatterns)
+}
+
+// IsAuthFailure tests to see if err is a GitError caused by
+// failing to authenticate to a remote.
+func IsAuthFailure(err error) bool {
+	return gitErrorMatches(err, authFailurePatterns)
+}
+
+// AmbiguousRefError is returned when a name could refer
+// to more than one ref.
+type AmbiguousRefError struct {
+	Name string
+	// Candidates holds the full names of the refs Name could mean.
+	Candidates []string
+}
+
+func (e *AmbiguousRefError) Error() string {
+	return fmt.Sprintf("%s is ambiguous, it could be any of %s", e.Name, strings.Join(e.Candidates, ", "))
+}
+
+// BadBaseError is returned when the base passed to Branch or Tag
+// does not resolve to something a branch or tag can point at.
+type BadBaseError struct {
+	Base string
+	// Err is the error we got trying to resolve Base.
+	Err error
+}
+
+func (e *BadBaseError) Error() string {
+	return fmt.Sprintf("%s does not resolve to anything that can be used as a base", e.Base)
+}
+
+func (e *BadBaseError) Unwrap() error {
+	return e.Err
+}
+
+// CheckoutError is returned when git refuses to check something
+// out because it would overwrite local changes or untracked files.
+type CheckoutError struct {
+	Ref string
+	// Files are the files that are in the way.
+	Files []string
+	// Err is the *GitError that git checkout failed with.
+	Err error
+}
+
+func (e *CheckoutError) Error() string {
+	return fmt.Sprintf("Cannot check out %s, it would overwrite %s", e.Ref, strings.Join(e.Files, ", "))
+}
+
+func (e *CheckoutError) Unwrap() error {
+	return e.Err
+}
+
+// newCheckoutError turns err into a *CheckoutError if git refused to
+// check ref out because of files in the way, and returns it unchanged
+// otherwise.
+func newCheckoutError(ref string, err error) error {
+	var gitErr *GitError
+	if !errors.As(err, &gitErr) || !strings.Contains(gitErr.Stderr, "would be overwritten by checkout") {
+		return err
+	}
+	res := &CheckoutError{Ref: ref, Err: err}
+	// git lists the files indented with a tab, after the line that
+	// says what kind of files they are.
+	for _, line := range strings.Split(gitErr.Stderr, "\n") {
+		if strings.HasPrefix(line, "\t") {
+			res.Files = append(res.Files, diffPath(strings.TrimSpace(line), ""))
+		}
+	}
+	return res
+}
@@ -0,0 +1,53 @@
+package git
+
+import "testing"
+
+func TestParseFetch(t *testing.T) {
+	out := "From /tmp/up\n" +
+		"   1a2b3c4..5d6e7f8  main       -> origin/main\n" +
+		" + 1a2b3c4...5d6e7f8 wip        -> origin/wip  (forced update)\n" +
+		" * [new branch]      feature/x  -> origin/feature/x\n" +
+		" * [new tag]         v1.0       -> v1.0\n" +
+		" ! [rejected]        v0.9       -> v0.9  (would clobber existing tag)\n" +
+		" - [deleted]         (none)     -> origin/gone\n" +
+		"error: some other noise\n"
+	want := []FetchUpdate{
+		{Flag: ' ', Summary: "1a2b3c4..5d6e7f8", From: "main", To: "origin/main"},
+		{Flag: '+', Summary: "1a2b3c4...5d6e7f8", From: "wip", To: "origin/wip", Reason: "forced update"},
+		{Flag: '*', Summary: "[new branch]", From: "feature/x", To: "origin/feature/x"},
+		{Flag: '*', Summary: "[new tag]", From: "v1.0", To: "v1.0"},
+		{Flag: '!', Summary: "[rejected]", From: "v0.9", To: "v0.9", Reason: "would clobber existing tag"},
+		{Flag: '-', Summary: "[deleted]", To: "origin/gone"},
+	}
+	got := parseFetch(out)
+	if len(got) != len(want) {
+		t.Fatalf("parseFetch = %+v", got)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("update %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseFetchPorcelain(t *testing.T) {
+	const (
+		zero = "0000000000000000000000000000000000000000"
+		a    = "0123456789abcdef0123456789abcdef01234567"
+		b    = "89abcdef0123456789abcdef0123456789abcdef"
+	)
+	for _, tc := range []struct {
+		line string
+		want FetchUpdate
+	}{
+		{"  " + a + " " + b + " refs/remotes/origin/main", FetchUpdate{Flag: ' ', OldSHA: a, NewSHA: b, To: "refs/remotes/origin/main"}},
+		{"* " + zero + " " + b + " refs/tags/v1", FetchUpdate{Flag: '*', NewSHA: b, To: "refs/tags/v1"}},
+		{"- " + a + " " + zero + " refs/remotes/origin/gone", FetchUpdate{Flag: '-', OldSHA: a, To: "refs/remotes/origin/gone"}},
+		{"= " + a + " " + a + " refs/remotes/origin/same", FetchUpdate{Flag: '=', OldSHA: a, NewSHA: a, To: "refs/remotes/origin/same"}},
+	} {
+		got := parseFetchPorcelain(tc.line + "\n")
+		if len(got) != 1 || got[0] != tc.want {
+			t.Errorf("parseFetchPorcelain(%q) = %+v, want %+v", tc.line, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package git
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// FsckSeverity is how bad a problem found by Fsck is.
+type FsckSeverity int
+
+const (
+	// FsckInfo is for things that are not problems, like dangling objects.
+	FsckInfo FsckSeverity = iota
+	// FsckWarning is for objects that git can use, but that break
+	// its rules about how objects should look.
+	FsckWarning
+	// FsckError is for missing or corrupt objects, and objects
+	// that git would refuse to create.
+	FsckError
+)
+
+func (s FsckSeverity) String() string {
+	switch s {
+	case FsckInfo:
+		return "info"
+	case FsckWarning:
+		return "warning"
+	}
+	return "error"
+}
+
+// MarshalText makes FsckSeveritys show up by name in JSON.
+func (s FsckSeverity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// FsckFinding is something git fsck found.
+type FsckFinding struct {
+	Severity FsckSeverity
+	// Kind is "dangling", "unreachable", "root", "missing",
+	// "broken link", "corrupt", or "notice".  For problems with the
+	// contents of an object, Kind is git's message ID, like "badName".
+	// Anything else git complains about has a Kind of "error".
+	Kind string
+	// Type and SHA are the object the finding is about,
+	// when there is one.  With NameObjects, Name is how
+	// that object can be reached from a ref.
+	Type, SHA, Name string
+	// Target and TargetType are the object a broken link points at.
+	Target, TargetType string
+	// Message is the explanation git gave, if any.
+	Message string
+}
+
+// FsckOptions controls what Fsck checks and reports.
+type FsckOptions struct {
+	// Unreachable reports every unreachable object,
+	// not just the dangling ones.
+	Unreachable bool
+	// NoDangling stops dangling objects from being reported.
+	NoDangling bool
+	// Root reports root commits.
+	Root bool
+	// Strict checks for more things that git normally lets slide,
+	// like group-writable file modes in trees.
+	Strict bool
+	// ConnectivityOnly only checks that reachable objects exist,
+	// without checking that they are well-formed.  It is much faster.
+	ConnectivityOnly bool
+	// NameObjects says how each object can be reached from a ref.
+	NameObjects bool
+}
+
+func (o FsckOptions) args() []string {
+	args := []string{"--full", "--no-progress"}
+	if o.Unreachable {
+		args = append(args, "--unreachable")
+	}
+	if o.NoDangling {
+		args = append(args, "--no-dangling")
+	}
+	if o.Root {
+		args = append(args, "--root")
+	}
+	if o.Strict {
+		args = append(args, "--strict")
+	}
+	if o.ConnectivityOnly {
+		args = append(args, "--connectivity-only")
+	}
+	if o.NameObjects {
+		args = append(args, "--name-objects")
+	}
+	return args
+}
+
+var (
+	// <kind> <type> <sha> [(<name>)], or root <sha> [(<name>)]
+	fsckObjectRE = regexp.MustCompile(`^(dangling|unreachable|missing|root) (?:(\w+) )?([0-9a-f]{40,64})(?: \((.*)\))?$`)
+	// the two lines of broken link from <type> <sha> [(<name>)]
+	//                             to <type> <sha> [(<name>)]
+	fsckLinkRE = regexp.MustCompile(`^\s*(?:broken link from|to)\s+(\w+) ([0-9a-f]{40,64})(?: \((.*)\))?$`)
+	// error in <type> <sha>: <msg-id>: <message>
+	fsckBadObjectRE = regexp.MustCompile(`^(error|warning) in (\w+) ([0-9a-f]{40,64})(?: \((.*)\))?: (\w+): (.*)$`)
+	// error: <sha>: object corrupt or missing: <path>
+	fsckCorruptRE = regexp.MustCompile(`^error: ([0-9a-f]{40,64}): object corrupt or missing: (.*)$`)
+)
+
+// parseFsck turns what git fsck printed into findings.
+func parseFsck(out string) (res []FsckFinding) {
+	res = make([]FsckFinding, 0)
+	lines := strings.Split(out, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if m := fsckObjectRE.FindStringSubmatch(line); m != nil {
+			finding := FsckFinding{Severity: FsckInfo, Kind: m[1], Type: m[2], SHA: m[3], Name: m[4]}
+			if finding.Kind == "root" {
+				finding.Type = "commit"
+			}
+			if finding.Kind == "missing" {
+				finding.Severity = FsckError
+			}
+			res = append(res, finding)
+			continue
+		}
+		if strings.HasPrefix(line, "broken link from") && i+1 < len(lines) {
+			from, to := fsckLinkRE.FindStringSubmatch(line), fsckLinkRE.FindStringSubmatch(lines[i+1])
+			if from != nil && to != nil {
+				res = append(res, FsckFinding{
+					Severity:   FsckError,
+					Kind:       "broken link",
+					Type:       from[1],
+					SHA:        from[2],
+					Name:       from[3],
+					TargetType: to[1],
+					Target:     to[2],
+				})
+				i++
+				continue
+			}
+		}
+		if m := fsckBadObjectRE.FindStringSubmatch(line); m != nil {
+			finding := FsckFinding{Severity: FsckError, Kind: m[5], Type: m[2], SHA: m[3], Name: m[4], Message: m[6]}
+			if m[1] == "warning" {
+				finding.Severity = FsckWarning
+			}
+			res = append(res, finding)
+			continue
+		}
+		if m := fsckCorruptRE.FindStringSubmatch(line); m != nil {
+			res = append(res, FsckFinding{Severity: FsckError, Kind: "corrupt", SHA: m[1], Message: m[2]})
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "notice: "):
+			res = append(res, FsckFinding{Severity: FsckInfo, Kind: "notice", Message: strings.TrimPrefix(line, "notice: ")})
+		case strings.HasPrefix(line, "error: "):
+			res = append(res, FsckFinding{Severity: FsckError, Kind: "error", Message: strings.TrimPrefix(line, "error: ")})
+		}
+	}
+	return res
+}
+
+// Fsck checks the objects in the repository for problems.
+// Problems that git fsck finds are returned as findings, not as an error.
+// If git fsck gives up part way through (which it does for some kinds
+// of corruption), the findings it made so far are returned along
+// with the error it failed with.
+func (r *Repo) Fsck(opts FsckOptions) (res []FsckFinding, err error) {
+	cmd, out, stderr := r.Git("fsck", opts.args()...)
+	err = run(cmd)
+	res = append(parseFsck(out.String()), parseFsck(stderr.String())...)
+	var gitErr *GitError
+	if err != nil && errors.As(err, &gitErr) && gitErr.ExitCode > 0 && gitErr.ExitCode < 128 {
+		// git fsck exits non-zero when it finds problems.
+		err = nil
+	}
+	return res, err
+}
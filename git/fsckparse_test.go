@@ -0,0 +1,49 @@
+package git
+
+import "testing"
+
+func TestParseFsck(t *testing.T) {
+	const (
+		a = "0123456789abcdef0123456789abcdef01234567"
+		b = "89abcdef0123456789abcdef0123456789abcdef"
+	)
+	for _, tc := range []struct {
+		out  string
+		want []FsckFinding
+	}{
+		{"", []FsckFinding{}},
+		{"dangling commit " + a + "\n",
+			[]FsckFinding{{Severity: FsckInfo, Kind: "dangling", Type: "commit", SHA: a}}},
+		{"unreachable blob " + a + " (HEAD~2:a file)\n",
+			[]FsckFinding{{Severity: FsckInfo, Kind: "unreachable", Type: "blob", SHA: a, Name: "HEAD~2:a file"}}},
+		{"root " + a + "\n",
+			[]FsckFinding{{Severity: FsckInfo, Kind: "root", Type: "commit", SHA: a}}},
+		{"missing tree " + a + "\n",
+			[]FsckFinding{{Severity: FsckError, Kind: "missing", Type: "tree", SHA: a}}},
+		{"broken link from  commit " + a + " (HEAD)\n              to    tree " + b + "\n",
+			[]FsckFinding{{Severity: FsckError, Kind: "broken link", Type: "commit", SHA: a, Name: "HEAD", TargetType: "tree", Target: b}}},
+		{"warning in tree " + a + ": zeroPaddedFilemode: contains zero-padded file modes\n",
+			[]FsckFinding{{Severity: FsckWarning, Kind: "zeroPaddedFilemode", Type: "tree", SHA: a, Message: "contains zero-padded file modes"}}},
+		{"error in commit " + a + ": missingAuthor: invalid format - expected 'author' line\n",
+			[]FsckFinding{{Severity: FsckError, Kind: "missingAuthor", Type: "commit", SHA: a, Message: "invalid format - expected 'author' line"}}},
+		{"error: " + a + ": object corrupt or missing: .git/objects/01/23\n",
+			[]FsckFinding{{Severity: FsckError, Kind: "corrupt", SHA: a, Message: ".git/objects/01/23"}}},
+		{"notice: HEAD points to an unborn branch (main)\nerror: refs/heads/x: invalid sha1 pointer " + a + "\n",
+			[]FsckFinding{
+				{Severity: FsckInfo, Kind: "notice", Message: "HEAD points to an unborn branch (main)"},
+				{Severity: FsckError, Kind: "error", Message: "refs/heads/x: invalid sha1 pointer " + a},
+			}},
+		{"Checking object directories\nsomething else\n", []FsckFinding{}},
+	} {
+		got := parseFsck(tc.out)
+		if len(got) != len(tc.want) {
+			t.Errorf("parseFsck(%q) = %+v, want %+v", tc.out, got, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("parseFsck(%q)[%d] = %+v, want %+v", tc.out, i, got[i], tc.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	os.Setenv("GIT_AUTHOR_NAME", "T")
+	os.Setenv("GIT_AUTHOR_EMAIL", "t@e")
+	os.Setenv("GIT_COMMITTER_NAME", "T")
+	os.Setenv("GIT_COMMITTER_EMAIL", "t@e")
+	os.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	os.Exit(m.Run())
+}
+
+func newRepo(t *testing.T) *Repo {
+	d := t.TempDir()
+	r, err := Init(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func write(t *testing.T, r *Repo, p, c string) {
+	full := filepath.Join(r.WorkDir, p)
+	os.MkdirAll(filepath.Dir(full), 0755)
+	if err := ioutil.WriteFile(full, []byte(c), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sh(t *testing.T, r *Repo, args ...string) string {
+	cmd, out, e := r.Git(args[0], args[1:]...)
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("%v: %s", args, e.String())
+	}
+	return out.String()
+}
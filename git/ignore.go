@@ -0,0 +1,152 @@
+package git
+
+import (
+	"bufio"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// IgnoreMatch is what CheckIgnore found out about a path.
+type IgnoreMatch struct {
+	Path string
+	// Ignored is true if the path is ignored.
+	Ignored bool
+	// Source, Line, and Pattern are where the pattern that decided
+	// about the path came from.  They are empty if no pattern matched.
+	// A pattern that starts with ! un-ignores the path.
+	Source  string
+	Line    int
+	Pattern string
+}
+
+// ignoreChecker is a git check-ignore --stdin process that is kept
+// running, so that checking paths does not cost a process each time.
+type ignoreChecker struct {
+	mu  sync.Mutex
+	cmd *exec.Cmd
+	in  io.WriteCloser
+	out *bufio.Reader
+}
+
+func (r *Repo) startIgnoreChecker() (res *ignoreChecker, err error) {
+	// -n makes git answer for every path, matched or not,
+	// so that the answers line up with the questions.
+	cmd, _, _ := r.Git("check-ignore", "--stdin", "-z", "-v", "-n")
+	// Without GIT_FLUSH, git holds on to its answers until stdin is closed.
+	cmd.Env = append(cmd.Env, "GIT_FLUSH=1")
+	cmd.Stdout = nil
+	res = &ignoreChecker{cmd: cmd}
+	if res.in, err = cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	res.out = bufio.NewReader(out)
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *ignoreChecker) field() (string, error) {
+	field, err := c.out.ReadString(0)
+	return strings.TrimSuffix(field, "\x00"), err
+}
+
+func (c *ignoreChecker) check(paths []string) (res []IgnoreMatch, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Write in the background, so that git does not get stuck
+	// writing answers that we are not reading yet.
+	written := make(chan error, 1)
+	go func() {
+		var err error
+		for _, path := range paths {
+			if _, err = io.WriteString(c.in, path+"\x00"); err != nil {
+				break
+			}
+		}
+		written <- err
+	}()
+	res = make([]IgnoreMatch, 0, len(paths))
+	for range paths {
+		var fields [4]string
+		for i := range fields {
+			if fields[i], err = c.field(); err != nil {
+				return nil, err
+			}
+		}
+		res = append(res, IgnoreMatch{
+			Source:  fields[0],
+			Line:    atoiDefault(fields[1], 0),
+			Pattern: fields[2],
+			Path:    fields[3],
+			Ignored: fields[2] != "" && !strings.HasPrefix(fields[2], "!"),
+		})
+	}
+	return res, <-written
+}
+
+func (c *ignoreChecker) close() error {
+	c.in.Close()
+	return wait(c.cmd)
+}
+
+// CheckIgnore checks which of paths are ignored, and which pattern
+// decided about each of them.  It keeps a git check-ignore process
+// running between calls, so it is cheap to call often.  Call
+// StopCheckIgnore to get rid of the process once it is not needed.
+func (r *Repo) CheckIgnore(paths []string) (res []IgnoreMatch, err error) {
+	if len(paths) == 0 {
+		return []IgnoreMatch{}, nil
+	}
+	r.mu.Lock()
+	if r.ignores == nil {
+		if r.ignores, err = r.startIgnoreChecker(); err != nil {
+			r.mu.Unlock()
+			return nil, err
+		}
+	}
+	checker := r.ignores
+	r.mu.Unlock()
+	if res, err = checker.check(paths); err != nil {
+		// Start over with a new process next time.
+		r.mu.Lock()
+		if r.ignores == checker {
+			r.ignores = nil
+		}
+		r.mu.Unlock()
+		checker.cmd.Process.Kill()
+		checker.close()
+		return nil, err
+	}
+	return res, nil
+}
+
+// IsIgnored tests to see if path is ignored.
+func (r *Repo) IsIgnored(path string) (res bool, err error) {
+	matches, err := r.CheckIgnore([]string{path})
+	if err != nil {
+		return false, err
+	}
+	return matches[0].Ignored, nil
+}
+
+// StopCheckIgnore stops the git check-ignore process that CheckIgnore
+// keeps running, if there is one.
+func (r *Repo) StopCheckIgnore() (err error) {
+	r.mu.Lock()
+	checker := r.ignores
+	r.ignores = nil
+	r.mu.Unlock()
+	if checker == nil {
+		return nil
+	}
+	checker.mu.Lock()
+	defer checker.mu.Unlock()
+	return checker.close()
+}
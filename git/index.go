@@ -0,0 +1,210 @@
+package git
+
+import (
+	"errors"
+	"strings"
+)
+
+func (r *Repo) stage(op string, args ...string) (err error) {
+	cmd, _, _ := r.Git(op, args...)
+	if err = run(cmd); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Add stages the current contents of paths in the index.
+// If no paths are passed, all changes in the working tree are staged.
+func (r *Repo) Add(paths ...string) (err error) {
+	if len(paths) == 0 {
+		return r.stage("add", "-A")
+	}
+	return r.stage("add", append([]string{"--"}, paths...)...)
+}
+
+// Remove removes paths from both the index and the working tree.
+func (r *Repo) Remove(paths ...string) (err error) {
+	if len(paths) == 0 {
+		return errors.New("No paths to remove!")
+	}
+	return r.stage("rm", append([]string{"-q", "--"}, paths...)...)
+}
+
+// RemoveCached removes paths from the index, but leaves them
+// alone in the working tree.
+func (r *Repo) RemoveCached(paths ...string) (err error) {
+	if len(paths) == 0 {
+		return errors.New("No paths to remove!")
+	}
+	return r.stage("rm", append([]string{"-q", "--cached", "--"}, paths...)...)
+}
+
+// MoveFile moves or renames a file, and stages the move in the index.
+func (r *Repo) MoveFile(old, nuevo string) (err error) {
+	return r.stage("mv", "--", old, nuevo)
+}
+
+// AddCacheInfo places the object sha into the index at path with the
+// given mode (such as "100644"), without needing path to exist in the
+// working tree.  This lets commits be built out of objects that were
+// written straight into the object store.
+func (r *Repo) AddCacheInfo(mode, sha, path string) (err error) {
+	return r.stage("update-index", "--add", "--cacheinfo", mode+","+sha+","+path)
+}
+
+// LsFilesOptions controls which files LsFiles lists.
+// With none of Others, Ignored, Deleted, Modified, or Unmerged set,
+// LsFiles lists the files in the index, as if Cached were set.
+type LsFilesOptions struct {
+	// Cached lists the files in the index.
+	Cached bool
+	// Others lists untracked files, and Ignored lists the ignored ones.
+	// Both use the standard exclude files (.gitignore and friends).
+	Others, Ignored bool
+	// Deleted and Modified list the files in the index that
+	// are deleted or modified in the working tree.
+	Deleted, Modified bool
+	// Unmerged lists the unmerged entries, one for each stage.
+	Unmerged bool
+	// Paths limits the listing to these pathspecs.
+	Paths []string
+}
+
+func (o LsFilesOptions) args() []string {
+	args := []string{"-z", "-t", "--stage"}
+	if o.Cached {
+		args = append(args, "--cached")
+	}
+	if o.Others || o.Ignored {
+		args = append(args, "--exclude-standard")
+	}
+	if o.Others {
+		args = append(args, "--others")
+	}
+	if o.Ignored {
+		args = append(args, "--ignored")
+		if !o.Others {
+			// --ignored needs something to pick ignored files out of.
+			args = append(args, "--others")
+		}
+	}
+	if o.Deleted {
+		args = append(args, "--deleted")
+	}
+	if o.Modified {
+		args = append(args, "--modified")
+	}
+	if o.Unmerged {
+		args = append(args, "--unmerged")
+	}
+	return append(append(args, "--"), o.Paths...)
+}
+
+// IndexEntry is a file listed by LsFiles.
+type IndexEntry struct {
+	Path string
+	// Mode, SHA, and Stage describe the entry in the index.
+	// They are empty for files that are not in the index.
+	// Stage is 0 for merged entries, and 1, 2, or 3 for the base,
+	// ours, and theirs versions of an unmerged one.
+	Mode, SHA string
+	Stage     int
+	// Status is the tag git ls-files -t gives the entry:
+	// 'H' for cached, 'S' for skip-worktree, 'M' for unmerged,
+	// 'R' for deleted, 'C' for modified, 'K' for to be killed,
+	// and '?' for untracked or ignored files.
+	Status byte
+}
+
+// LsFiles lists files in the index and the working tree.
+// A file can be listed more than once, if it is (for example) both
+// in the index and deleted from the working tree.
+func (r *Repo) LsFiles(opts LsFilesOptions) (res []IndexEntry, err error) {
+	cmd, out, _ := r.Git("ls-files", opts.args()...)
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	// --stage implies --cached, so weed out the cached entries
+	// if they were not asked for.
+	cached := opts.Cached || !(opts.Others || opts.Ignored || opts.Deleted || opts.Modified || opts.Unmerged)
+	res = make([]IndexEntry, 0)
+	for _, record := range strings.Split(out.String(), "\x00") {
+		// <tag> SP <path> or
+		// <tag> SP <mode> SP <sha> SP <stage> TAB <path>
+		if len(record) < 3 || record[1] != ' ' {
+			continue
+		}
+		entry := IndexEntry{Status: record[0], Path: record[2:]}
+		switch {
+		case cached:
+		case entry.Status == 'H', entry.Status == 'S':
+			continue
+		case entry.Status == 'M' && !opts.Unmerged:
+			continue
+		}
+		if parts := strings.SplitN(record[2:], "\t", 2); len(parts) == 2 && entry.Status != '?' {
+			if fields := strings.Fields(parts[0]); len(fields) == 3 {
+				entry.Mode, entry.SHA = fields[0], fields[1]
+				entry.Stage = atoiDefault(fields[2], 0)
+				entry.Path = parts[1]
+			}
+		}
+		res = append(res, entry)
+	}
+	return res, nil
+}
+
+// CleanOptions controls what Clean removes.
+type CleanOptions struct {
+	// Force has to be set for git to remove anything,
+	// unless clean.requireForce is turned off.
+	Force bool
+	// Directories removes untracked directories as well as files.
+	Directories bool
+	// Ignored removes ignored files along with untracked ones,
+	// and OnlyIgnored removes just the ignored files.
+	Ignored, OnlyIgnored bool
+	// DryRun lists what would be removed without removing it.
+	DryRun bool
+	// Paths limits the cleaning to these pathspecs.
+	Paths []string
+}
+
+func (o CleanOptions) args() []string {
+	args := []string{}
+	if o.Force {
+		args = append(args, "--force")
+	}
+	if o.Directories {
+		args = append(args, "-d")
+	}
+	if o.Ignored {
+		args = append(args, "-x")
+	}
+	if o.OnlyIgnored {
+		args = append(args, "-X")
+	}
+	if o.DryRun {
+		args = append(args, "--dry-run")
+	}
+	return append(append(args, "--"), o.Paths...)
+}
+
+// Clean removes untracked files from the working tree, and returns
+// the paths that were removed (or would be, with DryRun).
+// Directories are returned with a trailing /.
+func (r *Repo) Clean(opts CleanOptions) (res []string, err error) {
+	cmd, out, _ := r.Git("clean", opts.args()...)
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	res = []string{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		for _, prefix := range []string{"Removing ", "Would remove "} {
+			if strings.HasPrefix(line, prefix) {
+				res = append(res, diffPath(strings.TrimPrefix(line, prefix), ""))
+			}
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,115 @@
+package git
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// IndexBuilder builds commits in a temporary index, without
+// disturbing the real index or the working tree.  This lets
+// commits be made in a repository that someone is working in,
+// or in a bare one.
+//
+// An IndexBuilder starts out empty.  Call ReadTree to start from
+// what a ref has in it, make changes with AddBlob, AddFile, and
+// RemoveFile, and then Commit.  Call Close once done with it.
+type IndexBuilder struct {
+	r     *Repo
+	index string
+}
+
+// NewIndexBuilder makes an IndexBuilder with an empty temporary index.
+func (r *Repo) NewIndexBuilder() (res *IndexBuilder, err error) {
+	f, err := ioutil.TempFile(r.GitDir, "index-builder-")
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	// git wants the index to either be valid or not exist at all.
+	if err = os.Remove(f.Name()); err != nil {
+		return nil, err
+	}
+	return &IndexBuilder{r: r, index: f.Name()}, nil
+}
+
+// git makes a command that runs against the temporary index.
+func (b *IndexBuilder) git(cmd string, args ...string) (res *exec.Cmd, out *bytes.Buffer) {
+	res, out, _ = b.r.Git(cmd, args...)
+	res.Env = append(res.Env, "GIT_INDEX_FILE="+b.index)
+	return res, out
+}
+
+// ReadTree replaces the contents of the index with the tree ref points at.
+func (b *IndexBuilder) ReadTree(ref *Ref) (err error) {
+	cmd, _ := b.git("read-tree", ref.SHA)
+	return run(cmd)
+}
+
+// AddBlob places the object sha in the index at path with
+// the given mode (such as "100644").
+func (b *IndexBuilder) AddBlob(mode, sha, path string) (err error) {
+	cmd, _ := b.git("update-index", "--add", "--cacheinfo", mode+","+sha+","+path)
+	return run(cmd)
+}
+
+// AddFile writes content to the object store, and places it
+// in the index at path as a regular file.
+func (b *IndexBuilder) AddFile(path string, content io.Reader) (err error) {
+	sha, err := b.r.WriteBlob(content)
+	if err != nil {
+		return err
+	}
+	return b.AddBlob("100644", sha, path)
+}
+
+// RemoveFile removes path from the index.
+func (b *IndexBuilder) RemoveFile(path string) (err error) {
+	cmd, _ := b.git("update-index", "--force-remove", "--", path)
+	return run(cmd)
+}
+
+// WriteTree writes the index out as a tree object, and returns its SHA.
+func (b *IndexBuilder) WriteTree() (sha string, err error) {
+	cmd, out := b.git("write-tree")
+	if err = run(cmd); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// Commit commits the index on top of ref, and moves ref to the
+// new commit.  If ref has moved since it was loaded, nothing
+// is changed and an error is returned, so that no one else's
+// commits are lost.  author is passed on to CommitTree.
+// If ref is the branch that is checked out, the real index and
+// working tree are not updated to match the new commit.
+func (b *IndexBuilder) Commit(ref *Ref, msg string, author ...Signature) (res *Ref, err error) {
+	tree, err := b.WriteTree()
+	if err != nil {
+		return nil, err
+	}
+	parents := []string{}
+	if ref.SHA != "" {
+		parents = append(parents, ref.SHA)
+	}
+	res, err = b.r.CommitTree(tree, parents, msg, author...)
+	if err != nil {
+		return nil, err
+	}
+	if err = ref.UpdateTo(res.SHA); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Close removes the temporary index.
+func (b *IndexBuilder) Close() (err error) {
+	if err = os.Remove(b.index); os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
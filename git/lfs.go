@@ -0,0 +1,163 @@
+package git
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// ErrLFSNotInstalled is returned by the LFS methods
+// when git lfs is not installed.
+var ErrLFSNotInstalled = errors.New("git lfs is not installed")
+
+// lfs runs git lfs with args, and returns ErrLFSNotInstalled
+// if git does not know about the lfs command.
+func (r *Repo) lfs(args ...string) (out string, err error) {
+	cmd, stdout, _ := r.Git("lfs", args...)
+	if err = run(cmd); err != nil {
+		if gitErrorMatches(err, []string{"'lfs' is not a git command"}) {
+			return "", ErrLFSNotInstalled
+		}
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+// LFSAvailable tests to see if git lfs is installed.
+func LFSAvailable() bool {
+	cmd, _, _ := Git("lfs", "version")
+	return cmd.Run() == nil
+}
+
+// UsesLFS tests to see if any of the files in the index are
+// stored with git lfs, according to their gitattributes.
+// It does not need git lfs to be installed.
+func (r *Repo) UsesLFS() (bool, error) {
+	entries, err := r.LsFiles(LsFilesOptions{Cached: true})
+	if err != nil {
+		return false, err
+	}
+	if len(entries) == 0 {
+		return false, nil
+	}
+	paths := make([]string, len(entries))
+	for i := range entries {
+		paths[i] = entries[i].Path
+	}
+	attrs, err := r.CheckAttr([]string{"filter"}, paths)
+	if err != nil {
+		return false, err
+	}
+	for _, attr := range attrs {
+		if attr["filter"] == "lfs" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// LFSTrack makes git lfs store files matching pattern,
+// by adding it to .gitattributes.
+func (r *Repo) LFSTrack(pattern string) (err error) {
+	_, err = r.lfs("track", "--", pattern)
+	return err
+}
+
+// LFSUntrack stops git lfs from storing files matching pattern,
+// by removing it from .gitattributes.
+func (r *Repo) LFSUntrack(pattern string) (err error) {
+	_, err = r.lfs("untrack", "--", pattern)
+	return err
+}
+
+// lfsDefaultRemote returns the remote that the current branch
+// tracks, or origin if it does not track one.
+func (r *Repo) lfsDefaultRemote() string {
+	if current, _ := r.CurrentRef(); current != nil {
+		if remote, err := current.Tracks(); err == nil {
+			return remote
+		}
+	}
+	return "origin"
+}
+
+// lfsTransfer runs a git lfs command that talks to remote.
+func (r *Repo) lfsTransfer(op, remote string, refs []string) (err error) {
+	args := []string{op}
+	if remote == "" && len(refs) > 0 {
+		// git lfs would take the first ref as the remote.
+		remote = r.lfsDefaultRemote()
+	}
+	if remote != "" {
+		args = append(args, remote)
+	}
+	_, err = r.lfs(append(args, refs...)...)
+	return err
+}
+
+// LFSFetch downloads the LFS objects for refs from remote,
+// without updating the working tree.  If refs is empty,
+// git lfs fetches the objects for the current branch.
+// If remote is empty, the remote the current branch tracks is
+// used, or origin if it does not track one.
+func (r *Repo) LFSFetch(remote string, refs ...string) (err error) {
+	return r.lfsTransfer("fetch", remote, refs)
+}
+
+// LFSPull downloads the LFS objects for refs from remote,
+// and checks them out in the working tree.  refs and remote
+// default the same way they do for LFSFetch.
+func (r *Repo) LFSPull(remote string, refs ...string) (err error) {
+	return r.lfsTransfer("pull", remote, refs)
+}
+
+// LFSPush uploads the LFS objects referenced by refs to remote.
+// If refs is empty, the objects for all refs are pushed.
+func (r *Repo) LFSPush(remote string, refs ...string) (err error) {
+	if remote == "" {
+		return errors.New("LFSPush needs a remote!")
+	}
+	if len(refs) == 0 {
+		return r.lfsTransfer("push", remote, []string{"--all"})
+	}
+	return r.lfsTransfer("push", remote, refs)
+}
+
+// LFSStatusEntry is a file stored with git lfs
+// that has changes waiting to be committed.
+type LFSStatusEntry struct {
+	Path string `json:"path"`
+	// From is the path the file was renamed from, if it was renamed.
+	From string `json:"from,omitempty"`
+	// State is what happened to the file, as with StatusEntry.
+	State FileState `json:"state"`
+}
+
+// LFSStatus lists the files stored with git lfs
+// that have changes waiting to be committed.
+func (r *Repo) LFSStatus() (res []LFSStatusEntry, err error) {
+	out, err := r.lfs("status", "--json")
+	if err != nil {
+		return nil, err
+	}
+	var status struct {
+		Files map[string]struct {
+			Status string `json:"status"`
+			From   string `json:"from"`
+		} `json:"files"`
+	}
+	if err = json.Unmarshal([]byte(strings.TrimSpace(out)), &status); err != nil {
+		return nil, err
+	}
+	res = make([]LFSStatusEntry, 0, len(status.Files))
+	for path, file := range status.Files {
+		entry := LFSStatusEntry{Path: path, From: file.From, State: StateModified}
+		if file.Status != "" {
+			entry.State = FileState(file.Status[0])
+		}
+		res = append(res, entry)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Path < res[j].Path })
+	return res, nil
+}
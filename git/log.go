@@ -0,0 +1,223 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signature identifies who authored or committed a change, and when.
+type Signature struct {
+	Name, Email string
+	When        time.Time
+}
+
+// Commit holds the interesting bits of a commit object.
+type Commit struct {
+	SHA string
+	// Tree is the SHA of the tree object this commit points at.
+	Tree string
+	// Parents holds the SHAs of the parent commits, in order.
+	Parents           []string
+	Author, Committer Signature
+	// Subject is the first paragraph of the commit message,
+	// and Body is the rest of it.
+	Subject, Body string
+	// Message is the full, unmangled commit message.
+	Message string
+}
+
+// commitFormat is the --format we feed to git log and friends
+// to get output that parseCommit can understand.
+// Fields are separated by ASCII unit separators.  The message is
+// last, since it is the only field that can hold anything at all.
+const commitFormat = "%H%x1f%T%x1f%P%x1f%an%x1f%ae%x1f%at%x1f%cn%x1f%ce%x1f%ct%x1f%B"
+
+func parseTime(unix string) time.Time {
+	secs, _ := strconv.ParseInt(unix, 10, 64)
+	return time.Unix(secs, 0)
+}
+
+// splitMessage splits a commit message into its subject and body,
+// the same way that git's %s and %b do.
+func splitMessage(msg string) (subject, body string) {
+	lines := strings.Split(msg, "\n")
+	i := 0
+	for i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+		i++
+	}
+	para := []string{}
+	for ; i < len(lines) && strings.TrimSpace(lines[i]) != ""; i++ {
+		para = append(para, strings.TrimRight(lines[i], " \t\r"))
+	}
+	for i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+		i++
+	}
+	return strings.Join(para, " "), strings.TrimRight(strings.Join(lines[i:], "\n"), "\n")
+}
+
+func parseCommit(record string) (res *Commit, err error) {
+	parts := strings.SplitN(strings.TrimLeft(record, "\n"), "\x1f", 10)
+	if len(parts) != 10 {
+		return nil, fmt.Errorf("Cannot parse commit record %q", record)
+	}
+	res = &Commit{
+		SHA:       parts[0],
+		Tree:      parts[1],
+		Parents:   strings.Fields(parts[2]),
+		Author:    Signature{Name: parts[3], Email: parts[4], When: parseTime(parts[5])},
+		Committer: Signature{Name: parts[6], Email: parts[7], When: parseTime(parts[8])},
+		Message:   parts[9],
+	}
+	res.Subject, res.Body = splitMessage(res.Message)
+	return res, nil
+}
+
+// LogOptions controls which commits Log walks over.
+type LogOptions struct {
+	// Revs holds the revisions and ranges to walk, such as
+	// "master", "v1.0..v2.0", or "^origin/master".
+	// If empty, Log walks from HEAD.
+	Revs []string
+	// Paths limits the walk to commits that touch these paths.
+	Paths []string
+	// Since and Until limit the walk to commits made in that
+	// time span, if they are not zero.
+	Since, Until time.Time
+	// Author limits the walk to commits whose author matches this pattern.
+	Author string
+	// MaxCount limits the number of commits returned, if it is positive.
+	MaxCount int
+}
+
+func (o LogOptions) args() []string {
+	args := []string{"-z", "--format=" + commitFormat}
+	if !o.Since.IsZero() {
+		args = append(args, "--since="+o.Since.Format(time.RFC3339))
+	}
+	if !o.Until.IsZero() {
+		args = append(args, "--until="+o.Until.Format(time.RFC3339))
+	}
+	if o.Author != "" {
+		args = append(args, "--author="+o.Author)
+	}
+	if o.MaxCount > 0 {
+		args = append(args, "--max-count="+strconv.Itoa(o.MaxCount))
+	}
+	if len(o.Revs) == 0 {
+		args = append(args, "HEAD")
+	} else {
+		args = append(args, o.Revs...)
+	}
+	args = append(args, "--")
+	return append(args, o.Paths...)
+}
+
+// CommitIter walks over the commits that git log emits, one at a time.
+// It is used like a bufio.Scanner:
+//
+//	iter, err := repo.Log(opts)
+//	...
+//	defer iter.Close()
+//	for iter.Next() {
+//		c := iter.Commit()
+//		...
+//	}
+//	if err := iter.Err(); err != nil {
+//		...
+//	}
+type CommitIter struct {
+	cmd     *exec.Cmd
+	out     io.ReadCloser
+	scanner *bufio.Scanner
+	current *Commit
+	err     error
+	done    bool
+}
+
+func scanNUL(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// Log starts walking the commit history as specified by opts.
+// The returned CommitIter must be closed when you are done with it.
+func (r *Repo) Log(opts LogOptions) (iter *CommitIter, err error) {
+	cmd, _, _ := r.Git("log", opts.args()...)
+	cmd.Stdout = nil
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	iter = &CommitIter{cmd: cmd, out: out, scanner: bufio.NewScanner(out)}
+	iter.scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	iter.scanner.Split(scanNUL)
+	return iter, nil
+}
+
+// Next advances to the next commit, which will then be available via Commit.
+// It returns false when there are no more commits or an error happened.
+func (i *CommitIter) Next() bool {
+	if i.done {
+		return false
+	}
+	if !i.scanner.Scan() {
+		i.finish(i.scanner.Err())
+		return false
+	}
+	i.current, i.err = parseCommit(i.scanner.Text())
+	if i.err != nil {
+		i.finish(i.err)
+		return false
+	}
+	return true
+}
+
+// Commit returns the commit that the most recent call to Next found.
+func (i *CommitIter) Commit() *Commit {
+	return i.current
+}
+
+// Err returns the first error that happened while walking the history, if any.
+func (i *CommitIter) Err() error {
+	return i.err
+}
+
+// Close stops the walk and cleans up after the git log process.
+func (i *CommitIter) Close() error {
+	if !i.done {
+		i.out.Close()
+		i.cmd.Process.Kill()
+		i.cmd.Wait()
+		i.done = true
+	}
+	return nil
+}
+
+func (i *CommitIter) finish(err error) {
+	i.done = true
+	i.current = nil
+	if err != nil {
+		// git may still have plenty to say, so make it stop
+		// instead of waiting for it to fill the pipe and block.
+		i.out.Close()
+		i.cmd.Process.Kill()
+		i.cmd.Wait()
+		i.err = err
+		return
+	}
+	i.err = wait(i.cmd)
+}
@@ -0,0 +1,68 @@
+package git
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestSplitMessage(t *testing.T) {
+	for _, tc := range []struct {
+		msg, subject, body string
+	}{
+		{"subject\n", "subject", ""},
+		{"subject\n\nbody\n", "subject", "body"},
+		{"\n\nsubject\n\n\nbody\n\nmore\n", "subject", "body\n\nmore"},
+		{"two line  \nsubject\n\nbody", "two line subject", "body"},
+		{"", "", ""},
+	} {
+		subject, body := splitMessage(tc.msg)
+		if subject != tc.subject || body != tc.body {
+			t.Errorf("splitMessage(%q) = %q, %q", tc.msg, subject, body)
+		}
+	}
+}
+
+func TestParseCommitRecords(t *testing.T) {
+	record := func(sha, parents, msg string) string {
+		return strings.Join([]string{sha, "tree", parents, "A", "a@e", "100", "C", "c@e", "200", msg}, "\x1f")
+	}
+	// git log -z separates records with NULs.  Messages can hold
+	// anything but a NUL, including the unit separator.
+	out := record("c1", "p1 p2", "merge\n\nwith body\n") + "\x00" +
+		record("c2", "", "odd \x1f subject\n") + "\x00" +
+		record("c3", "p3", "\n")
+	want := []struct {
+		sha, subject, body string
+		parents            int
+	}{
+		{"c1", "merge", "with body", 2},
+		{"c2", "odd \x1f subject", "", 0},
+		{"c3", "", "", 1},
+	}
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	scanner.Split(scanNUL)
+	i := 0
+	for ; scanner.Scan(); i++ {
+		c, err := parseCommit(scanner.Text())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i >= len(want) {
+			t.Fatalf("extra commit %+v", c)
+		}
+		w := want[i]
+		if c.SHA != w.sha || c.Subject != w.subject || c.Body != w.body || len(c.Parents) != w.parents {
+			t.Errorf("commit %d = %+v", i, c)
+		}
+		if c.Author.Email != "a@e" || c.Committer.When.Unix() != 200 {
+			t.Errorf("commit %d signatures = %+v, %+v", i, c.Author, c.Committer)
+		}
+	}
+	if i != len(want) {
+		t.Errorf("got %d commits, want %d", i, len(want))
+	}
+	if _, err := parseCommit("too\x1ffew"); err == nil {
+		t.Error("parseCommit of a short record did not fail")
+	}
+}
@@ -0,0 +1,215 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GCOptions controls how GC cleans up the repository.
+type GCOptions struct {
+	// Aggressive spends much more time to pack the repository
+	// more tightly.
+	Aggressive bool
+	// Auto only does anything if git thinks the repository
+	// needs it, as with the housekeeping git does after commands
+	// like commit and fetch.
+	Auto bool
+	// Prune removes unreachable loose objects older than this date,
+	// which can be "now", "never", or an approxidate like
+	// "2.weeks.ago".  If empty, gc.pruneExpire is used.
+	Prune string
+	// NoPrune keeps unreachable loose objects, no matter how old.
+	NoPrune bool
+}
+
+func (o GCOptions) args() []string {
+	args := []string{"--quiet"}
+	if o.Aggressive {
+		args = append(args, "--aggressive")
+	}
+	if o.Auto {
+		args = append(args, "--auto")
+	}
+	if o.NoPrune {
+		args = append(args, "--no-prune")
+	} else if o.Prune != "" {
+		args = append(args, "--prune="+o.Prune)
+	}
+	return args
+}
+
+// GC cleans up unneeded files and packs the repository.
+func (r *Repo) GC(opts GCOptions) (err error) {
+	cmd, _, _ := r.Git("gc", opts.args()...)
+	return run(cmd)
+}
+
+// RepackOptions controls how Repack packs the repository.
+type RepackOptions struct {
+	// All packs everything into a single pack, instead of just
+	// packing the loose objects.
+	All bool
+	// Delete removes packs and loose objects that the
+	// new pack makes redundant.
+	Delete bool
+	// WriteBitmapIndex writes a reachability bitmap along with the
+	// pack, which speeds up clones and fetches from it.  It only
+	// works along with All.
+	WriteBitmapIndex bool
+	// Window and Depth tune delta compression.  Bigger values
+	// make smaller packs, but take longer.  If zero,
+	// pack.window and pack.depth are used.
+	Window, Depth int
+}
+
+func (o RepackOptions) args() []string {
+	args := []string{"-q"}
+	if o.All {
+		args = append(args, "-a")
+	}
+	if o.Delete {
+		args = append(args, "-d")
+	}
+	if o.WriteBitmapIndex {
+		args = append(args, "--write-bitmap-index")
+	}
+	if o.Window > 0 {
+		args = append(args, "--window="+strconv.Itoa(o.Window))
+	}
+	if o.Depth > 0 {
+		args = append(args, "--depth="+strconv.Itoa(o.Depth))
+	}
+	return args
+}
+
+// Repack packs the objects in the repository.
+func (r *Repo) Repack(opts RepackOptions) (err error) {
+	cmd, _, _ := r.Git("repack", opts.args()...)
+	return run(cmd)
+}
+
+// PruneObjects removes unreachable loose objects that are older than
+// expire.  If expire is zero, all unreachable loose objects are removed,
+// which is only safe if nothing else is using the repository.
+func (r *Repo) PruneObjects(expire time.Duration) (err error) {
+	arg := "--expire=now"
+	if expire > 0 {
+		arg = fmt.Sprintf("--expire=%d.seconds.ago", int64(expire/time.Second))
+	}
+	cmd, _, _ := r.Git("prune", arg)
+	return run(cmd)
+}
+
+// CommitGraphOptions controls how WriteCommitGraph writes the commit-graph.
+type CommitGraphOptions struct {
+	// Split adds the commits that are not in the commit-graph yet
+	// as a new layer, instead of rewriting the whole thing.
+	Split bool
+	// ChangedPaths records which paths each commit changed,
+	// which speeds up log and blame of a path.
+	ChangedPaths bool
+}
+
+func (o CommitGraphOptions) args() []string {
+	args := []string{"write", "--reachable", "--no-progress"}
+	if o.Split {
+		args = append(args, "--split")
+	}
+	if o.ChangedPaths {
+		args = append(args, "--changed-paths")
+	}
+	return args
+}
+
+// WriteCommitGraph writes a commit-graph for every commit reachable
+// from a ref.  git uses the commit-graph to walk history without
+// parsing each commit, which makes things like Contains and
+// AheadBehind much faster on repositories with long histories.
+func (r *Repo) WriteCommitGraph(opts CommitGraphOptions) (err error) {
+	cmd, _, _ := r.Git("commit-graph", opts.args()...)
+	return run(cmd)
+}
+
+// VerifyCommitGraph checks that the commit-graph matches the commits
+// it describes.
+func (r *Repo) VerifyCommitGraph() (err error) {
+	cmd, _, _ := r.Git("commit-graph", "verify", "--no-progress")
+	return run(cmd)
+}
+
+// HasCommitGraph tests to see if the repository has a commit-graph.
+// If it does not, WriteCommitGraph will make history queries faster.
+func (r *Repo) HasCommitGraph() bool {
+	cmd, out, _ := r.Git("rev-parse", "--git-path", "objects/info/commit-graph", "--git-path", "objects/info/commit-graphs/commit-graph-chain")
+	if run(cmd) != nil {
+		return false
+	}
+	for _, path := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(cmd.Dir, path)
+		}
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// autoCommitGraph writes a commit-graph if AutoCommitGraph is set
+// and the repository does not have one.  It only checks once.
+// Failing to write one is not an error, since it only
+// makes things faster.
+func (r *Repo) autoCommitGraph() {
+	if !r.AutoCommitGraph {
+		return
+	}
+	r.graphOnce.Do(func() {
+		if !r.HasCommitGraph() {
+			r.WriteCommitGraph(CommitGraphOptions{})
+		}
+	})
+}
+
+// Maintenance runs a single git maintenance task, such as "gc",
+// "commit-graph", "prefetch", "loose-objects", "incremental-repack",
+// or "pack-refs".  If task is empty, the tasks that
+// git maintenance runs by default are run.
+func (r *Repo) Maintenance(task string) (err error) {
+	args := []string{"run", "--quiet"}
+	if task != "" {
+		args = append(args, "--task="+task)
+	}
+	cmd, _, _ := r.Git("maintenance", args...)
+	if err = run(cmd); err != nil {
+		return err
+	}
+	r.ReloadRefs()
+	return nil
+}
+
+// MaintenanceStart registers the repository for background
+// maintenance, and sets up the system scheduler to run it.
+func (r *Repo) MaintenanceStart() (err error) {
+	cmd, _, _ := r.Git("maintenance", "start")
+	if err = run(cmd); err != nil {
+		return err
+	}
+	r.ReloadConfig()
+	return nil
+}
+
+// MaintenanceStop unregisters the repository from background
+// maintenance.  The system scheduler is left alone, since other
+// repositories may still be registered with it.
+func (r *Repo) MaintenanceStop() (err error) {
+	cmd, _, _ := r.Git("maintenance", "unregister")
+	if err = run(cmd); err != nil {
+		return err
+	}
+	r.ReloadConfig()
+	return nil
+}
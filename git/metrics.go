@@ -0,0 +1,285 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Metric is a single sample of a gauge.
+type Metric struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+// metricHelp holds the gauges a Collector exports, in the order
+// they are written out, along with their help text.
+var metricHelp = []struct{ name, help string }{
+	{"git_refs", "Number of refs, by namespace."},
+	{"git_remote_last_fetch_age_seconds", "Seconds since the last fetch from a remote."},
+	{"git_repo_size_bytes", "Size of the object store on disk."},
+	{"git_loose_objects", "Number of loose objects."},
+	{"git_dirty", "1 if the working tree has uncommitted or untracked changes."},
+}
+
+// Collector gathers health metrics about a set of repositories,
+// and can write them out in the Prometheus text format.
+// It is an http.Handler, so it can be mounted on a metrics endpoint.
+type Collector struct {
+	// Repos maps the value of the "repo" label to the
+	// repository to collect metrics for.
+	Repos map[string]*Repo
+}
+
+// NewCollector makes a Collector for repos, labelled by their paths.
+func NewCollector(repos ...*Repo) *Collector {
+	res := &Collector{Repos: make(map[string]*Repo)}
+	for _, r := range repos {
+		res.Repos[r.Path()] = r
+	}
+	return res
+}
+
+// Stats describes how much space a repository's objects take up,
+// as reported by git count-objects.  Sizes are in bytes.
+type Stats struct {
+	// LooseObjects and LooseSize are the number and size
+	// of objects that are not in a pack.
+	LooseObjects, LooseSize int64
+	// PackedObjects, Packs, and PackSize are the number of objects
+	// in packs, the number of packs, and the size of the packs.
+	PackedObjects, Packs, PackSize int64
+	// PrunePackable is the number of loose objects that are
+	// also in a pack, which git prune-packed can remove.
+	PrunePackable int64
+	// Garbage and GarbageSize are the number and size of files
+	// in the object store that are neither objects nor packs.
+	Garbage, GarbageSize int64
+}
+
+// TotalSize is the size of everything in the object store.
+func (s *Stats) TotalSize() int64 {
+	return s.LooseSize + s.PackSize + s.GarbageSize
+}
+
+// humanSize formats a size in bytes with binary units, the way git does.
+func humanSize(size int64) string {
+	units := []string{"bytes", "KiB", "MiB", "GiB", "TiB"}
+	val, unit := float64(size), 0
+	for val >= 1024 && unit < len(units)-1 {
+		val /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d %s", size, units[0])
+	}
+	return fmt.Sprintf("%.2f %s", val, units[unit])
+}
+
+func (s *Stats) String() string {
+	res := fmt.Sprintf("%d loose objects (%s), %d objects in %d packs (%s)",
+		s.LooseObjects, humanSize(s.LooseSize),
+		s.PackedObjects, s.Packs, humanSize(s.PackSize))
+	if s.PrunePackable > 0 {
+		res += fmt.Sprintf(", %d prunable", s.PrunePackable)
+	}
+	if s.Garbage > 0 {
+		res += fmt.Sprintf(", %d garbage files (%s)", s.Garbage, humanSize(s.GarbageSize))
+	}
+	return res
+}
+
+// Stats counts the objects in the repository and the space they take up.
+func (r *Repo) Stats() (res *Stats, err error) {
+	cmd, out, _ := r.Git("count-objects", "-v")
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	res = &Stats{}
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ": ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		val := int64(atoiDefault(parts[1], 0))
+		// count-objects reports sizes in KiB.
+		switch parts[0] {
+		case "count":
+			res.LooseObjects = val
+		case "size":
+			res.LooseSize = val * 1024
+		case "in-pack":
+			res.PackedObjects = val
+		case "packs":
+			res.Packs = val
+		case "size-pack":
+			res.PackSize = val * 1024
+		case "prune-packable":
+			res.PrunePackable = val
+		case "garbage":
+			res.Garbage = val
+		case "size-garbage":
+			res.GarbageSize = val * 1024
+		}
+	}
+	return res, nil
+}
+
+// fetchHeadURL mangles url the way git does before it writes it
+// into FETCH_HEAD: any username and password are dropped, along with
+// trailing slashes and then a trailing .git.
+func fetchHeadURL(url string) string {
+	if i := strings.Index(url, "://"); i >= 0 {
+		rest := url[i+3:]
+		host := rest
+		if j := strings.Index(rest, "/"); j >= 0 {
+			host = rest[:j]
+		}
+		if at := strings.LastIndex(host, "@"); at >= 0 {
+			url = url[:i+3] + rest[at+1:]
+		}
+	} else if isSCPLike(url) {
+		if at := strings.Index(url, "@"); at >= 0 && at < strings.Index(url, ":") {
+			url = url[at+1:]
+		}
+	}
+	url = strings.TrimRight(url, "/")
+	if len(url) > 5 {
+		url = strings.TrimSuffix(url, ".git")
+	}
+	return url
+}
+
+// fetchAges works out how long ago each remote was fetched from.
+// git only remembers the last fetch, in FETCH_HEAD, so remotes
+// that were not part of it are left out.
+func (r *Repo) fetchAges() (res map[string]time.Duration) {
+	res = make(map[string]time.Duration)
+	fetchHead := filepath.Join(r.GitDir, "FETCH_HEAD")
+	fi, err := os.Stat(fetchHead)
+	if err != nil {
+		return res
+	}
+	buf, err := ioutil.ReadFile(fetchHead)
+	if err != nil {
+		return res
+	}
+	age := time.Since(fi.ModTime())
+	for remote, rm := range r.Remotes() {
+		if strings.Contains(string(buf), " of "+fetchHeadURL(rm.FetchURL)+"\n") {
+			res[remote] = age
+		}
+	}
+	return res
+}
+
+func (c *Collector) collectOne(name string, r *Repo) (res []Metric, err error) {
+	summary, err := r.RefSummary()
+	if err != nil {
+		return nil, err
+	}
+	for ns, count := range summary {
+		res = append(res, Metric{"git_refs", map[string]string{"repo": name, "namespace": ns}, float64(count)})
+	}
+	for remote, age := range r.fetchAges() {
+		res = append(res, Metric{"git_remote_last_fetch_age_seconds",
+			map[string]string{"repo": name, "remote": remote}, age.Seconds()})
+	}
+	stats, err := r.Stats()
+	if err != nil {
+		return nil, err
+	}
+	res = append(res,
+		Metric{"git_repo_size_bytes", map[string]string{"repo": name}, float64(stats.TotalSize())},
+		Metric{"git_loose_objects", map[string]string{"repo": name}, float64(stats.LooseObjects)})
+	if !r.IsRaw() {
+		info, err := r.PromptInfo()
+		if err != nil {
+			return nil, err
+		}
+		dirty := 0.0
+		if !info.Clean() {
+			dirty = 1
+		}
+		res = append(res, Metric{"git_dirty", map[string]string{"repo": name}, dirty})
+	}
+	return res, nil
+}
+
+// Collect gathers the metrics for every repository.
+func (c *Collector) Collect() (res []Metric, err error) {
+	names := make([]string, 0, len(c.Repos))
+	for name := range c.Repos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	res = make([]Metric, 0)
+	for _, name := range names {
+		metrics, err := c.collectOne(name, c.Repos[name])
+		if err != nil {
+			return nil, fmt.Errorf("Collecting metrics for %s: %v", name, err)
+		}
+		res = append(res, metrics...)
+	}
+	return res, nil
+}
+
+func (m Metric) String() string {
+	keys := make([]string, 0, len(m.Labels))
+	for k := range m.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	labels := make([]string, 0, len(keys))
+	for _, k := range keys {
+		labels = append(labels, fmt.Sprintf("%s=%q", k, m.Labels[k]))
+	}
+	return fmt.Sprintf("%s{%s} %g", m.Name, strings.Join(labels, ","), m.Value)
+}
+
+// WriteTo collects the metrics and writes them to w
+// in the Prometheus text exposition format.
+func (c *Collector) WriteTo(w io.Writer) (n int64, err error) {
+	metrics, err := c.Collect()
+	if err != nil {
+		return 0, err
+	}
+	byName := make(map[string][]string)
+	for _, m := range metrics {
+		byName[m.Name] = append(byName[m.Name], m.String())
+	}
+	buf := &strings.Builder{}
+	for _, h := range metricHelp {
+		samples := byName[h.name]
+		if len(samples) == 0 {
+			continue
+		}
+		sort.Strings(samples)
+		fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s gauge\n", h.name, h.help, h.name)
+		for _, sample := range samples {
+			fmt.Fprintln(buf, sample)
+		}
+	}
+	written, err := io.WriteString(w, buf.String())
+	return int64(written), err
+}
+
+// ServeHTTP writes the metrics out for a scraper.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	buf := &strings.Builder{}
+	if _, err := c.WriteTo(buf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	io.WriteString(w, buf.String())
+}
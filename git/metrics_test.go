@@ -0,0 +1,39 @@
+package git
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestFetchHeadURL(t *testing.T) {
+	for _, tc := range []struct{ url, want string }{
+		{"/tmp/fa/src.git", "/tmp/fa/src"},
+		{"/tmp/fa/src.git/", "/tmp/fa/src"},
+		{"/tmp/fa/src/", "/tmp/fa/src"},
+		{"/tmp/fa/src", "/tmp/fa/src"},
+		{"https://user:pw@example.com/x/y.git", "https://example.com/x/y"},
+		{"ssh://git@example.com/x/y", "ssh://example.com/x/y"},
+		{"git@github.com:foo/bar.git", "github.com:foo/bar"},
+		{"a.git", "a.git"},
+	} {
+		if got := fetchHeadURL(tc.url); got != tc.want {
+			t.Errorf("fetchHeadURL(%q) = %q, want %q", tc.url, got, tc.want)
+		}
+	}
+}
+
+func TestFetchAgesDotGit(t *testing.T) {
+	src, err := Init(filepath.Join(t.TempDir(), "src.git"), "--bare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newRepo(t)
+	sh(t, r, "commit", "-qm", "a", "--allow-empty")
+	sh(t, r, "push", "-q", src.GitDir, "HEAD:refs/heads/master")
+	sh(t, r, "remote", "add", "up", src.GitDir)
+	sh(t, r, "fetch", "-q", "up")
+	r.ReloadConfig()
+	if _, found := r.fetchAges()["up"]; !found {
+		t.Fatalf("no fetch age for a remote with a .git URL: %v", r.fetchAges())
+	}
+}
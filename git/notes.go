@@ -0,0 +1,73 @@
+package git
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// notesRef turns a metadata namespace into the notes ref it lives in.
+func notesRef(namespace string) string {
+	if strings.HasPrefix(namespace, "refs/notes/") {
+		return namespace
+	}
+	return "refs/notes/" + namespace
+}
+
+// AttachMetadata records data (which must be valid JSON) against commit,
+// in a git note in the given namespace.  Metadata is appended to
+// whatever was already attached, one JSON document per line, so that
+// notes from different places can be merged with MergeMetadata.
+func (r *Repo) AttachMetadata(commit *Ref, namespace string, data []byte) (err error) {
+	buf := &bytes.Buffer{}
+	if err = json.Compact(buf, data); err != nil {
+		return fmt.Errorf("Metadata for %s is not valid JSON: %v", commit.SHA, err)
+	}
+	cmd, _, _ := r.Git("notes", "--ref="+notesRef(namespace), "append", "-m", buf.String(), commit.SHA)
+	if err = run(cmd); err != nil {
+		return err
+	}
+	r.ReloadRefs()
+	return nil
+}
+
+// Metadata returns the JSON documents attached to commit in namespace,
+// in the order they appear in the note.  A commit with nothing attached has no metadata,
+// and that is not an error.
+func (r *Repo) Metadata(commit *Ref, namespace string) (res []json.RawMessage, err error) {
+	cmd, out, _ := r.Git("notes", "--ref="+notesRef(namespace), "show", commit.SHA)
+	if err = run(cmd); err != nil {
+		var gitErr *GitError
+		if errors.As(err, &gitErr) && strings.Contains(gitErr.Stderr, "no note found") {
+			return []json.RawMessage{}, nil
+		}
+		return nil, err
+	}
+	res = make([]json.RawMessage, 0, 1)
+	for _, line := range strings.Split(out.String(), "\n") {
+		// git notes append separates each addition with a blank line.
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if !json.Valid([]byte(line)) {
+			return nil, fmt.Errorf("Metadata for %s in %s is not valid JSON: %q", commit.SHA, namespace, line)
+		}
+		res = append(res, json.RawMessage(line))
+	}
+	return res, nil
+}
+
+// MergeMetadata merges the notes in other (usually a ref fetched from
+// somewhere else, like "refs/notes/remotes/origin/ci") into namespace.
+// The cat_sort_uniq strategy is used, so metadata attached in both
+// places is kept, and exact duplicates are dropped.
+func (r *Repo) MergeMetadata(namespace, other string) (err error) {
+	cmd, _, _ := r.Git("notes", "--ref="+notesRef(namespace), "merge", "-q", "-s", "cat_sort_uniq", other)
+	if err = run(cmd); err != nil {
+		return err
+	}
+	r.ReloadRefs()
+	return nil
+}
@@ -0,0 +1,51 @@
+package git
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+type discard struct{}
+
+func (discard) Write(p []byte) (int, error) { return len(p), nil }
+func (discard) Close() error                { return nil }
+
+func TestBatchHeader(t *testing.T) {
+	for _, tc := range []struct {
+		line  string
+		typ   string
+		size  int64
+		found bool
+		fails bool
+	}{
+		{"0123abcd blob 12\n", "blob", 12, true, false},
+		{"HEAD:README missing\n", "", 0, false, false},
+		{"HEAD:my file missing\n", "", 0, false, false},
+		{"HEAD:a b c missing\n", "", 0, false, false},
+		{"abc ambiguous\n", "", 0, false, false},
+		{"0123abcd blob twelve\n", "blob", 0, false, true},
+		{"what now\n", "", 0, false, true},
+	} {
+		b := &batchProcess{in: discard{}, out: bufio.NewReader(strings.NewReader(tc.line))}
+		typ, size, found, err := b.header("x")
+		if typ != tc.typ || size != tc.size || found != tc.found || (err != nil) != tc.fails {
+			t.Errorf("header(%q) = %q, %d, %v, %v", tc.line, typ, size, found, err)
+		}
+	}
+}
+
+func TestReadObjectMissingWithSpace(t *testing.T) {
+	r := newRepo(t)
+	write(t, r, "my file", "hello\n")
+	sh(t, r, "add", ".")
+	sh(t, r, "commit", "-qm", "a")
+	o := r.ObjectReader()
+	defer o.Close()
+	if _, _, err := o.ReadObject("HEAD:no such file"); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("reading a missing object: %v", err)
+	}
+	if _, content, err := o.ReadObject("HEAD:my file"); err != nil || string(content) != "hello\n" {
+		t.Fatalf("ReadObject = %q, %v", content, err)
+	}
+}
@@ -0,0 +1,180 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// batchProcess is a git cat-file --batch or --batch-check process.
+type batchProcess struct {
+	cmd *exec.Cmd
+	in  io.WriteCloser
+	out *bufio.Reader
+}
+
+func (r *Repo) startBatch(mode string) (res *batchProcess, err error) {
+	cmd, _, _ := r.Git("cat-file", mode)
+	cmd.Stdout = nil
+	res = &batchProcess{cmd: cmd}
+	if res.in, err = cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	res.out = bufio.NewReader(out)
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// header asks for name, and reads the line git answers with:
+// <sha> SP <type> SP <size>, or <name> SP missing.
+// name can have spaces in it, so look for the missing
+// (or ambiguous) reply before splitting the line up.
+func (b *batchProcess) header(name string) (typ string, size int64, found bool, err error) {
+	if _, err = io.WriteString(b.in, name+"\n"); err != nil {
+		return "", 0, false, err
+	}
+	line, err := b.out.ReadString('\n')
+	if err != nil {
+		return "", 0, false, err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	if strings.HasSuffix(line, " missing") || strings.HasSuffix(line, " ambiguous") {
+		return "", 0, false, nil
+	}
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return "", 0, false, fmt.Errorf("Cannot parse cat-file header %q", line)
+	}
+	size, err = strconv.ParseInt(fields[2], 10, 64)
+	return fields[1], size, err == nil, err
+}
+
+func (b *batchProcess) close() error {
+	b.in.Close()
+	return wait(b.cmd)
+}
+
+// ObjectReader reads objects out of the object store through
+// long-running git cat-file --batch and --batch-check processes,
+// so that reading lots of objects does not cost a process each.
+// It is safe to use from more than one goroutine.
+// The processes are started when they are first needed,
+// and stopped by Close.
+type ObjectReader struct {
+	r     *Repo
+	mu    sync.Mutex
+	batch *batchProcess
+	check *batchProcess
+}
+
+// ObjectReader returns the ObjectReader for this repository.
+// Every call returns the same ObjectReader, so there is only
+// ever one set of cat-file processes per Repo.
+func (r *Repo) ObjectReader() *ObjectReader {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.objects == nil {
+		r.objects = &ObjectReader{r: r}
+	}
+	return r.objects
+}
+
+// use runs fn with the process *proc points at, starting it
+// with mode if it is not running.  If fn fails, the process
+// is thrown away, and a new one is started next time.
+func (o *ObjectReader) use(proc **batchProcess, mode string, fn func(*batchProcess) error) (err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if *proc == nil {
+		if *proc, err = o.r.startBatch(mode); err != nil {
+			return err
+		}
+	}
+	if err = fn(*proc); err != nil {
+		(*proc).cmd.Process.Kill()
+		(*proc).close()
+		*proc = nil
+	}
+	return err
+}
+
+// info looks up the type and size of the object name.
+func (o *ObjectReader) info(name string) (typ string, size int64, err error) {
+	if strings.Contains(name, "\n") {
+		return "", 0, fmt.Errorf("Invalid object name %q", name)
+	}
+	var found bool
+	err = o.use(&o.check, "--batch-check", func(b *batchProcess) (err error) {
+		typ, size, found, err = b.header(name)
+		return err
+	})
+	if err == nil && !found {
+		err = fmt.Errorf("Object %s does not exist", name)
+	}
+	return typ, size, err
+}
+
+// ObjectType gets the type of the object name, which can be a SHA
+// or anything else git can resolve, like "HEAD:README".
+func (o *ObjectReader) ObjectType(name string) (typ string, err error) {
+	typ, _, err = o.info(name)
+	return typ, err
+}
+
+// ObjectSize gets the size of the object name in bytes.
+func (o *ObjectReader) ObjectSize(name string) (size int64, err error) {
+	_, size, err = o.info(name)
+	return size, err
+}
+
+// ReadObject reads the type and contents of the object name.
+func (o *ObjectReader) ReadObject(name string) (typ string, content []byte, err error) {
+	if strings.Contains(name, "\n") {
+		return "", nil, fmt.Errorf("Invalid object name %q", name)
+	}
+	var found bool
+	err = o.use(&o.batch, "--batch", func(b *batchProcess) (err error) {
+		var size int64
+		if typ, size, found, err = b.header(name); err != nil || !found {
+			return err
+		}
+		// The contents are followed by a newline.
+		content = make([]byte, size+1)
+		if _, err = io.ReadFull(b.out, content); err != nil {
+			return err
+		}
+		content = content[:size]
+		return nil
+	})
+	if err == nil && !found {
+		err = fmt.Errorf("Object %s does not exist", name)
+	}
+	return typ, content, err
+}
+
+// Close stops the cat-file processes.  The ObjectReader can
+// still be used afterwards, and will start new ones.
+func (o *ObjectReader) Close() (err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, proc := range []**batchProcess{&o.batch, &o.check} {
+		if *proc == nil {
+			continue
+		}
+		if closeErr := (*proc).close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+		*proc = nil
+	}
+	return err
+}
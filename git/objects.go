@@ -0,0 +1,110 @@
+package git
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ObjectSize holds the size of a blob, and the path it was first seen at.
+type ObjectSize struct {
+	SHA, Path string
+	Size      int64
+}
+
+// eachBlob calls fn with every blob reachable from any ref, along with
+// the first path git found it at.
+func (r *Repo) eachBlob(fn func(ObjectSize)) (err error) {
+	revList, _, _ := r.Git("rev-list", "--objects", "--all")
+	revList.Stdout = nil
+	objects, err := revList.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	check, _, _ := r.Git("cat-file", "--batch-check=%(objecttype) %(objectname) %(objectsize) %(rest)")
+	check.Stdin = objects
+	check.Stdout = nil
+	sizes, err := check.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err = revList.Start(); err != nil {
+		return err
+	}
+	if err = check.Start(); err != nil {
+		revList.Process.Kill()
+		revList.Wait()
+		return err
+	}
+	scanner := bufio.NewScanner(sizes)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), " ", 4)
+		if len(parts) < 3 || parts[0] != "blob" {
+			continue
+		}
+		obj := ObjectSize{SHA: parts[1]}
+		obj.Size, _ = strconv.ParseInt(parts[2], 10, 64)
+		if len(parts) == 4 {
+			obj.Path = parts[3]
+		}
+		fn(obj)
+	}
+	if err = wait(revList); err != nil {
+		check.Wait()
+		return err
+	}
+	return wait(check)
+}
+
+// LargestObjects finds the n largest blobs anywhere in the history
+// of the repository, largest first.
+func (r *Repo) LargestObjects(n int) (res []ObjectSize, err error) {
+	if n <= 0 {
+		return []ObjectSize{}, nil
+	}
+	res = make([]ObjectSize, 0, n+1)
+	err = r.eachBlob(func(obj ObjectSize) {
+		if len(res) == n && obj.Size <= res[n-1].Size {
+			return
+		}
+		i := sort.Search(len(res), func(i int) bool { return res[i].Size < obj.Size })
+		res = append(res, ObjectSize{})
+		copy(res[i+1:], res[i:])
+		res[i] = obj
+		if len(res) > n {
+			res = res[:n]
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// PathsOverSize finds all the blobs anywhere in the history of
+// the repository that are larger than limit bytes.
+func (r *Repo) PathsOverSize(limit int64) (res []ObjectSize, err error) {
+	res = make([]ObjectSize, 0, 10)
+	err = r.eachBlob(func(obj ObjectSize) {
+		if obj.Size > limit {
+			res = append(res, obj)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// WriteBlob stores the contents of content in the object store
+// as a blob, and returns its SHA.  The working tree and index are
+// left alone, so this works in bare repositories too.
+func (r *Repo) WriteBlob(content io.Reader) (sha string, err error) {
+	cmd, out, _ := r.GitWithInput(content, "hash-object", "-w", "--stdin")
+	if err = run(cmd); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out.String()), nil
+}
@@ -0,0 +1,22 @@
+package git
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenBadPath(t *testing.T) {
+	r := newRepo(t)
+	write(t, r, "file", "x\n")
+	for _, path := range []string{
+		filepath.Join(r.WorkDir, "missing"),
+		filepath.Join(r.WorkDir, "file"),
+	} {
+		if _, err := Open(path); err == nil {
+			t.Errorf("Open(%q) did not fail", path)
+		}
+	}
+	if _, err := Open(filepath.Join(r.WorkDir, ".git")); err != nil {
+		t.Errorf("Open of a git directory failed: %v", err)
+	}
+}
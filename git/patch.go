@@ -0,0 +1,238 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SendEmailOptions controls how SendEmailPatches mails a patch series.
+type SendEmailOptions struct {
+	// From is the sender address.  If empty, git uses sendemail.from
+	// or the committer identity.
+	From string
+	// To, Cc, and Bcc are the recipient lists.
+	To, Cc, Bcc []string
+	// InReplyTo threads the series as a reply to this Message-Id.
+	InReplyTo string
+	// SMTPServer, SMTPPort, SMTPUser, and SMTPEncryption override the
+	// sendemail.smtp* settings from the git config.
+	SMTPServer     string
+	SMTPPort       int
+	SMTPUser       string
+	SMTPEncryption string
+	// SuppressCc is passed as --suppress-cc, e.g. "all" or "self".
+	SuppressCc string
+	// DryRun does everything except actually send the emails.
+	DryRun bool
+}
+
+func (o SendEmailOptions) args() []string {
+	args := []string{"--confirm=never", "--quiet"}
+	if o.From != "" {
+		args = append(args, "--from="+o.From)
+	}
+	for _, v := range o.To {
+		args = append(args, "--to="+v)
+	}
+	for _, v := range o.Cc {
+		args = append(args, "--cc="+v)
+	}
+	for _, v := range o.Bcc {
+		args = append(args, "--bcc="+v)
+	}
+	if o.InReplyTo != "" {
+		args = append(args, "--in-reply-to="+o.InReplyTo)
+	}
+	if o.SMTPServer != "" {
+		args = append(args, "--smtp-server="+o.SMTPServer)
+	}
+	if o.SMTPPort != 0 {
+		args = append(args, "--smtp-server-port="+strconv.Itoa(o.SMTPPort))
+	}
+	if o.SMTPUser != "" {
+		args = append(args, "--smtp-user="+o.SMTPUser)
+	}
+	if o.SMTPEncryption != "" {
+		args = append(args, "--smtp-encryption="+o.SMTPEncryption)
+	}
+	if o.SuppressCc != "" {
+		args = append(args, "--suppress-cc="+o.SuppressCc)
+	}
+	if o.DryRun {
+		args = append(args, "--dry-run")
+	}
+	return args
+}
+
+// SendEmailPatches mails a patch series using git send-email.
+// series can contain patch files, directories of patch files
+// (as generated by git format-patch), or revision ranges.
+func (r *Repo) SendEmailPatches(series []string, opts SendEmailOptions) (err error) {
+	if len(series) == 0 {
+		return errors.New("No patches to send!")
+	}
+	if len(opts.To) == 0 {
+		if _, found := r.Get("sendemail.to"); !found {
+			return fmt.Errorf("No recipients for %v", series)
+		}
+	}
+	cmd, _, _ := r.Git("send-email", append(opts.args(), series...)...)
+	if err = run(cmd); err != nil {
+		return err
+	}
+	return nil
+}
+
+// FormatPatchOptions controls how FormatPatch writes patches.
+type FormatPatchOptions struct {
+	// Numbered puts [PATCH n/m] in the subjects, even for a single patch.
+	Numbered bool
+	// StartNumber numbers the patches starting here instead of at 1.
+	StartNumber int
+	// CoverLetter also writes a cover letter to fill in.
+	CoverLetter bool
+	// Signoff adds a Signed-off-by trailer to each patch.
+	Signoff bool
+	// SubjectPrefix replaces PATCH in the subjects.
+	SubjectPrefix string
+}
+
+func (o FormatPatchOptions) args() []string {
+	args := []string{}
+	if o.Numbered {
+		args = append(args, "--numbered")
+	}
+	if o.StartNumber > 0 {
+		args = append(args, "--start-number="+strconv.Itoa(o.StartNumber))
+	}
+	if o.CoverLetter {
+		args = append(args, "--cover-letter")
+	}
+	if o.Signoff {
+		args = append(args, "--signoff")
+	}
+	if o.SubjectPrefix != "" {
+		args = append(args, "--subject-prefix="+o.SubjectPrefix)
+	}
+	return args
+}
+
+// FormatPatch writes each commit in revRange (as understood by
+// git format-patch, so a single ref means everything since that ref)
+// into its own mailbox file in dir, and returns the paths of the files.
+func (r *Repo) FormatPatch(revRange, dir string, opts FormatPatchOptions) (res []string, err error) {
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	args := append(opts.args(), "--output-directory", dir, revRange, "--")
+	cmd, out, _ := r.Git("format-patch", args...)
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	res = []string{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if line != "" {
+			res = append(res, line)
+		}
+	}
+	return res, nil
+}
+
+// AmOptions controls how Am applies patches.
+type AmOptions struct {
+	// ThreeWay falls back on a three-way merge if a patch
+	// does not apply cleanly.
+	ThreeWay bool
+	// Signoff adds a Signed-off-by trailer to each commit.
+	Signoff bool
+	// KeepCR keeps carriage returns at the ends of lines.
+	KeepCR bool
+}
+
+func (o AmOptions) args() []string {
+	args := []string{"--quiet"}
+	if o.ThreeWay {
+		args = append(args, "--3way")
+	}
+	if o.Signoff {
+		args = append(args, "--signoff")
+	}
+	if o.KeepCR {
+		args = append(args, "--keep-cr")
+	}
+	return args
+}
+
+// Am applies the patches in mbox, a mailbox like FormatPatch writes,
+// committing each of them on top of the current branch.
+// If a patch does not apply, Am returns an error and leaves the rest
+// of the patches waiting: resolve the problem and call AmContinue,
+// or call AmAbort to go back to where things were before Am.
+func (r *Repo) Am(mbox io.Reader, opts AmOptions) (err error) {
+	cmd, _, _ := r.GitWithInput(mbox, "am", opts.args()...)
+	err = run(cmd)
+	r.ReloadRefs()
+	return err
+}
+
+// AmContinue carries on applying patches after the problem
+// that stopped Am has been resolved and staged.
+func (r *Repo) AmContinue() (err error) {
+	cmd, _, _ := r.Git("am", "--continue")
+	err = run(cmd)
+	r.ReloadRefs()
+	return err
+}
+
+// AmAbort gives up on the patches that Am could not apply, and
+// puts the current branch back where it was before Am started.
+func (r *Repo) AmAbort() (err error) {
+	cmd, _, _ := r.Git("am", "--abort")
+	err = run(cmd)
+	r.ReloadRefs()
+	return err
+}
+
+// ApplyOptions controls how Apply applies a patch.
+type ApplyOptions struct {
+	// Cached applies the patch to the index only,
+	// without touching the working tree.
+	Cached bool
+	// ThreeWay falls back on a three-way merge if the patch
+	// does not apply cleanly, leaving conflicts behind.
+	ThreeWay bool
+	// Check only checks that the patch would apply, and changes nothing.
+	Check bool
+	// Reverse applies the patch backwards.
+	Reverse bool
+}
+
+func (o ApplyOptions) args() []string {
+	args := []string{}
+	if o.Cached {
+		args = append(args, "--cached")
+	}
+	if o.ThreeWay {
+		args = append(args, "--3way")
+	}
+	if o.Check {
+		args = append(args, "--check")
+	}
+	if o.Reverse {
+		args = append(args, "--reverse")
+	}
+	return args
+}
+
+// Apply applies patch, a diff like git diff makes, to the working tree
+// (or just to the index, with Cached).  The patch is read straight
+// from patch, so it does not need to be written to a file first.
+func (r *Repo) Apply(patch io.Reader, opts ApplyOptions) (err error) {
+	cmd, _, _ := r.GitWithInput(patch, "apply", opts.args()...)
+	return run(cmd)
+}
@@ -0,0 +1,129 @@
+package git
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// PinError is returned when a ref does not match what it was pinned to.
+type PinError struct {
+	Ref, Expected string
+	// Actual is what the ref points at, if it exists.
+	Actual string
+	Reason string
+}
+
+func (e *PinError) Error() string {
+	return fmt.Sprintf("%s is pinned to %s: %s", e.Ref, e.Expected, e.Reason)
+}
+
+// Pin is a ref that is expected to point at a particular object.
+type Pin struct {
+	Ref string
+	// SHA is the expected SHA.  It can be the SHA of the commit the
+	// ref points at, or of the annotated tag object, and can be
+	// abbreviated to no less than 7 characters.
+	SHA string
+	// VerifyTag also requires Ref to be a tag with a valid signature.
+	VerifyTag bool
+}
+
+// PinResult is what VerifyPins found out about a single Pin.
+type PinResult struct {
+	Pin
+	// Actual is the SHA the ref points at.
+	Actual string
+	// Verification holds the result of verifying the tag signature,
+	// if the Pin asked for it.
+	Verification *Verification
+	// Err is nil if the ref matches its pin.
+	Err error
+}
+
+// Ok tests to see if the ref matched its pin.
+func (p PinResult) Ok() bool {
+	return p.Err == nil
+}
+
+func shaMatches(expected, actual string) bool {
+	return len(expected) >= 7 && strings.HasPrefix(actual, strings.ToLower(expected))
+}
+
+// checkPin checks that refname (which names the ref the user calls name)
+// points at expected, and returns what it actually points at.
+func (r *Repo) checkPin(name, refname, expected string) (actual string, err error) {
+	shas := make([]string, 0, 2)
+	for _, rev := range []string{refname, refname + "^{commit}"} {
+		cmd, out, _ := r.Git("rev-parse", "-q", "--verify", rev)
+		if run(cmd) != nil {
+			return "", &PinError{Ref: name, Expected: expected, Reason: "it does not exist"}
+		}
+		shas = append(shas, strings.TrimSpace(out.String()))
+	}
+	for _, sha := range shas {
+		if shaMatches(expected, sha) {
+			return shas[0], nil
+		}
+	}
+	return shas[0], &PinError{Ref: name, Expected: expected, Actual: shas[0],
+		Reason: "it points at " + shas[0]}
+}
+
+// VerifyPin checks that ref points at expectedSHA in this repository.
+// If it does not, the returned error is a *PinError.
+func (r *Repo) VerifyPin(ref string, expectedSHA string) (err error) {
+	_, err = r.checkPin(ref, ref, expectedSHA)
+	return err
+}
+
+// VerifyPins fetches the pinned refs from remote (a remote name or a URL)
+// and checks each of them against its pin.  It returns a result for every
+// pin, and only returns an error if the fetch itself failed.
+// The refs are fetched into a scratch namespace, which is removed
+// afterwards, so the repository's own refs are left alone.
+func (r *Repo) VerifyPins(remote string, pins []Pin) (res []PinResult, err error) {
+	if len(pins) == 0 {
+		// A fetch with no refspecs would fetch everything.
+		return []PinResult{}, nil
+	}
+	// Use a namespace nobody else will, so that any refs already
+	// under refs/pins are not overwritten and then deleted.
+	suffix := make([]byte, 8)
+	if _, err = rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	namespace := fmt.Sprintf("refs/pins/%d-%x/", os.Getpid(), suffix)
+	scratch := make([]string, len(pins))
+	refspecs := make([]string, len(pins))
+	for i, pin := range pins {
+		scratch[i] = namespace + strconv.Itoa(i)
+		refspecs[i] = "+" + pin.Ref + ":" + scratch[i]
+	}
+	defer func() {
+		for _, ref := range scratch {
+			cmd, _, _ := r.Git("update-ref", "-d", ref)
+			cmd.Run()
+		}
+	}()
+	cmd, _, _ := r.Git("fetch", append([]string{"-q", "--no-tags", remote}, refspecs...)...)
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	res = make([]PinResult, len(pins))
+	for i, pin := range pins {
+		res[i].Pin = pin
+		res[i].Actual, res[i].Err = r.checkPin(pin.Ref, scratch[i], pin.SHA)
+		if res[i].Err != nil || !pin.VerifyTag {
+			continue
+		}
+		tag := &Ref{SHA: res[i].Actual, Path: scratch[i], r: r}
+		if res[i].Verification, res[i].Err = tag.VerifyTag(); res[i].Err == nil && !res[i].Verification.Valid {
+			res[i].Err = &PinError{Ref: pin.Ref, Expected: pin.SHA, Actual: res[i].Actual,
+				Reason: "it does not have a valid tag signature"}
+		}
+	}
+	return res, nil
+}
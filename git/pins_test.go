@@ -0,0 +1,26 @@
+package git
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyPinsEmpty(t *testing.T) {
+	up, err := Init(filepath.Join(t.TempDir(), "up.git"), "--bare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newRepo(t)
+	sh(t, r, "commit", "-qm", "a", "--allow-empty")
+	sh(t, r, "push", "-q", up.GitDir, "HEAD:refs/heads/master")
+	sh(t, r, "remote", "add", "up", up.GitDir)
+	r.ReloadConfig()
+	res, err := r.VerifyPins("up", nil)
+	if err != nil || len(res) != 0 {
+		t.Fatalf("VerifyPins = %v, %v", res, err)
+	}
+	r.ReloadRefs()
+	if r.HasRef("refs/remotes/up/master") {
+		t.Fatal("VerifyPins with no pins fetched from the remote")
+	}
+}
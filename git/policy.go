@@ -0,0 +1,143 @@
+package git
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Policy describes the rules that commits must follow.
+// Rules that are left at their zero value are not checked.
+type Policy struct {
+	// RequireSigned requires commits to have a good signature.
+	RequireSigned bool
+	// RequireTrailers requires commit messages to have these trailers,
+	// such as "Signed-off-by".
+	RequireTrailers []string
+	// ForbidMerges forbids merge commits.
+	ForbidMerges bool
+	// MaxSubjectLength is the longest a commit subject may be.
+	MaxSubjectLength int
+	// ForbiddenPaths holds path.Match patterns for paths that commits may not touch.
+	// A pattern that ends in / matches everything under that directory.
+	ForbiddenPaths []string
+}
+
+// Violation is a single broken rule.
+type Violation struct {
+	// Rule is the name of the Policy field that was violated.
+	Rule   string
+	Detail string
+}
+
+// PolicyResult holds the rules that a single commit broke.
+type PolicyResult struct {
+	SHA, Subject string
+	Violations   []Violation
+}
+
+// policyFormat is the --format CheckPolicy parses.
+// Each commit starts with an ASCII record separator so that the
+// --name-only output can be told apart from the next commit.
+const policyFormat = "%x1e%H%x1f%P%x1f%s%x1f%(trailers:only,unfold)"
+
+// format is the --format CheckPolicy passes to git log for p.
+// Checking signatures is slow, so %G? is only added to the end of
+// policyFormat when p needs it.
+func (p Policy) format() string {
+	if p.RequireSigned {
+		return policyFormat + "%x1f%G?"
+	}
+	return policyFormat
+}
+
+func (p Policy) forbids(name string) (pattern string, found bool) {
+	for _, pattern := range p.ForbiddenPaths {
+		if strings.HasSuffix(pattern, "/") {
+			if strings.HasPrefix(name, pattern) {
+				return pattern, true
+			}
+		} else if ok, _ := path.Match(pattern, name); ok {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+func (p Policy) check(parents []string, subject, trailers, sig string, paths []string) (res []Violation) {
+	if p.RequireSigned && sig != "G" && sig != "U" {
+		res = append(res, Violation{"RequireSigned", fmt.Sprintf("signature status is %s", sig)})
+	}
+	for _, want := range p.RequireTrailers {
+		found := false
+		for _, line := range strings.Split(trailers, "\n") {
+			parts := strings.SplitN(line, ":", 2)
+			if len(parts) == 2 && strings.EqualFold(strings.TrimSpace(parts[0]), want) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			res = append(res, Violation{"RequireTrailers", "missing " + want + " trailer"})
+		}
+	}
+	if p.ForbidMerges && len(parents) > 1 {
+		res = append(res, Violation{"ForbidMerges", fmt.Sprintf("has %d parents", len(parents))})
+	}
+	if p.MaxSubjectLength > 0 && len(subject) > p.MaxSubjectLength {
+		res = append(res, Violation{"MaxSubjectLength",
+			fmt.Sprintf("subject is %d characters long, limit is %d", len(subject), p.MaxSubjectLength)})
+	}
+	for _, name := range paths {
+		if pattern, found := p.forbids(name); found {
+			res = append(res, Violation{"ForbiddenPaths", fmt.Sprintf("%s matches %s", name, pattern)})
+		}
+	}
+	return res
+}
+
+// CheckPolicy checks every commit in revs (which are passed to git log,
+// so ranges like "origin/master..HEAD" work) against p.
+// It returns the commits that broke at least one rule.
+func (r *Repo) CheckPolicy(p Policy, revs ...string) (res []*PolicyResult, err error) {
+	args := []string{"-z", "--format=" + p.format()}
+	if len(p.ForbiddenPaths) > 0 {
+		args = append(args, "--name-only")
+	}
+	cmd, out, _ := r.Git("log", append(append(args, revs...), "--")...)
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	res = make([]*PolicyResult, 0)
+	for _, record := range strings.Split(out.String(), "\x1e") {
+		if record == "" {
+			continue
+		}
+		// The header is terminated by a NUL, and the paths
+		// that --name-only found come after it.
+		chunks := strings.Split(record, "\x00")
+		parts := strings.Split(chunks[0], "\x1f")
+		want := 4
+		if p.RequireSigned {
+			want = 5
+		}
+		if len(parts) != want {
+			return nil, fmt.Errorf("Cannot parse commit record %q", chunks[0])
+		}
+		sig := ""
+		if p.RequireSigned {
+			sig = parts[4]
+		}
+		paths := make([]string, 0, len(chunks))
+		for _, name := range chunks[1:] {
+			if name = strings.TrimLeft(name, "\n"); name != "" {
+				paths = append(paths, name)
+			}
+		}
+		violations := p.check(strings.Fields(parts[1]), parts[2], parts[3], sig, paths)
+		if len(violations) > 0 {
+			res = append(res, &PolicyResult{SHA: parts[0], Subject: parts[2], Violations: violations})
+		}
+	}
+	return res, nil
+}
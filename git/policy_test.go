@@ -0,0 +1,40 @@
+package git
+
+import "testing"
+
+func TestCheckPolicySigned(t *testing.T) {
+	r := newRepo(t)
+	sh(t, r, "commit", "-qm", "a subject that is long", "--allow-empty")
+	for _, tc := range []struct {
+		policy Policy
+		rules  []string
+	}{
+		{Policy{}, nil},
+		{Policy{MaxSubjectLength: 10}, []string{"MaxSubjectLength"}},
+		{Policy{RequireSigned: true}, []string{"RequireSigned"}},
+		{Policy{RequireSigned: true, MaxSubjectLength: 10}, []string{"RequireSigned", "MaxSubjectLength"}},
+	} {
+		res, err := r.CheckPolicy(tc.policy, "HEAD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rules []string
+		for _, pr := range res {
+			if pr.Subject != "a subject that is long" {
+				t.Errorf("%+v: subject = %q", tc.policy, pr.Subject)
+			}
+			for _, v := range pr.Violations {
+				rules = append(rules, v.Rule)
+			}
+		}
+		if len(rules) != len(tc.rules) {
+			t.Errorf("%+v: broke %v, want %v", tc.policy, rules, tc.rules)
+			continue
+		}
+		for i := range rules {
+			if rules[i] != tc.rules[i] {
+				t.Errorf("%+v: broke %v, want %v", tc.policy, rules, tc.rules)
+			}
+		}
+	}
+}
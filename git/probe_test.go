@@ -0,0 +1,24 @@
+package git
+
+import "testing"
+
+func TestProbeURL(t *testing.T) {
+	empty := newRepo(t)
+	full := newRepo(t)
+	sh(t, full, "commit", "-qm", "a", "--allow-empty")
+	for _, tc := range []struct {
+		name  string
+		url   string
+		found bool
+		fails bool
+	}{
+		{"empty", empty.Path(), true, false},
+		{"full", full.Path(), true, false},
+		{"missing", t.TempDir(), false, true},
+	} {
+		found, err := ProbeURL(tc.url)
+		if found != tc.found || (err != nil) != tc.fails {
+			t.Errorf("%s: ProbeURL = %v, %v", tc.name, found, err)
+		}
+	}
+}
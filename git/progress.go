@@ -0,0 +1,79 @@
+package git
+
+import (
+	"bytes"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// progressRE matches the progress lines git prints with --progress,
+// like "Receiving objects:  45% (450/1000), 1.20 MiB | 2.00 MiB/s"
+// or "remote: Enumerating objects: 1234, done."
+var progressRE = regexp.MustCompile(`^(?:remote: )?([A-Z][A-Za-z ]*?):\s+(?:\d+% \((\d+)/(\d+)\)|(\d+))`)
+
+// progressWriter collects the stderr of a git command run with
+// --progress.  It passes progress lines to fn as they arrive,
+// and keeps everything else for newGitError.
+// It must not embed the buffer, or io.Copy would use the buffer's
+// ReadFrom and never call Write.
+type progressWriter struct {
+	buf     *bytes.Buffer
+	fn      func(phase string, current, total int)
+	partial []byte
+}
+
+func (p *progressWriter) Write(buf []byte) (int, error) {
+	for _, c := range buf {
+		if c != '\r' && c != '\n' {
+			p.partial = append(p.partial, c)
+			continue
+		}
+		p.line(string(p.partial))
+		p.partial = p.partial[:0]
+	}
+	return len(buf), nil
+}
+
+func (p *progressWriter) line(line string) {
+	parts := progressRE.FindStringSubmatch(line)
+	if parts == nil {
+		if line != "" {
+			p.buf.WriteString(line + "\n")
+		}
+		return
+	}
+	if parts[4] != "" {
+		current, _ := strconv.Atoi(parts[4])
+		p.fn(parts[1], current, 0)
+		return
+	}
+	current, _ := strconv.Atoi(parts[2])
+	total, _ := strconv.Atoi(parts[3])
+	p.fn(parts[1], current, total)
+}
+
+func (p *progressWriter) String() string {
+	return p.buf.String() + string(p.partial)
+}
+
+// withProgress makes cmd report its progress to fn.
+// cmd must have been made by Git, and have --progress in its arguments.
+func withProgress(cmd *exec.Cmd, fn func(phase string, current, total int)) {
+	cmd.Stderr = &progressWriter{buf: cmd.Stderr.(*bytes.Buffer), fn: fn}
+}
+
+// serialProgress wraps fn so that it is never called from more than
+// one goroutine at a time.
+func serialProgress(fn func(phase string, current, total int)) func(phase string, current, total int) {
+	if fn == nil {
+		return nil
+	}
+	var mu sync.Mutex
+	return func(phase string, current, total int) {
+		mu.Lock()
+		defer mu.Unlock()
+		fn(phase, current, total)
+	}
+}
@@ -0,0 +1,80 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// PromptInfo is a summary of the state of a repository,
+// as a shell prompt or editor status line would want it.
+type PromptInfo struct {
+	// Branch is the short name of the checked out branch.
+	// If HEAD is detached, Branch is empty and Detached is true.
+	Branch   string
+	Detached bool
+	// SHA is the commit HEAD points at, and is empty in
+	// a repository that has no commits yet.
+	SHA string
+	// Upstream is the short name of the branch that Branch tracks, if any.
+	// Ahead and Behind count the commits that are only on Branch
+	// and only on Upstream.
+	Upstream      string
+	Ahead, Behind int
+	// Staged, Dirty, Untracked, and Conflicted count the paths
+	// that have changes in the index, changes in the working tree,
+	// are untracked, and have merge conflicts.
+	Staged, Dirty, Untracked, Conflicted int
+	// Operation is the operation that is in progress, if any:
+	// "merge", "rebase", "am", "cherry-pick", "revert", or "bisect".
+	Operation string
+}
+
+// Clean tests to see if there are no changes of any kind in the repository.
+func (p *PromptInfo) Clean() bool {
+	return p.Staged == 0 && p.Dirty == 0 && p.Untracked == 0 && p.Conflicted == 0
+}
+
+// operation works out what git is in the middle of from the
+// state files it leaves in the git directory.
+func (r *Repo) operation() string {
+	for _, op := range []struct{ file, name string }{
+		{"rebase-merge", "rebase"},
+		{"rebase-apply/applying", "am"},
+		{"rebase-apply", "rebase"},
+		{"MERGE_HEAD", "merge"},
+		{"CHERRY_PICK_HEAD", "cherry-pick"},
+		{"REVERT_HEAD", "revert"},
+		{"BISECT_LOG", "bisect"},
+	} {
+		if _, err := os.Stat(filepath.Join(r.GitDir, op.file)); err == nil {
+			return op.name
+		}
+	}
+	return ""
+}
+
+// PromptInfo gathers everything a prompt needs from a single git status.
+// It is meant to be called often, so unless r.Profile allows
+// OptionalLocks, it does not take any locks that might get in the
+// way of other git commands.
+func (r *Repo) PromptInfo() (res *PromptInfo, err error) {
+	cmd, out, _ := r.Git("status", "--porcelain=v2", "--branch", "-z")
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	status, _ := parseStatus(out.String())
+	res = &PromptInfo{
+		Branch:     status.Branch,
+		Detached:   status.Detached,
+		SHA:        status.SHA,
+		Upstream:   status.Upstream,
+		Ahead:      status.Ahead,
+		Behind:     status.Behind,
+		Staged:     len(status.Staged),
+		Dirty:      len(status.Unstaged),
+		Untracked:  len(status.Untracked),
+		Conflicted: len(status.Unmerged),
+		Operation:  r.operation(),
+	}
+	return res, nil
+}
@@ -0,0 +1,35 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPromptInfoOptionalLocks(t *testing.T) {
+	for _, locks := range []bool{false, true} {
+		r := newRepo(t)
+		write(t, r, "f", "x\n")
+		sh(t, r, "add", "f")
+		sh(t, r, "commit", "-qm", "a")
+		index := filepath.Join(r.GitDir, "index")
+		old := time.Now().Add(-time.Hour)
+		os.Chtimes(index, old, old)
+		// Make the index's stat data for f stale, so that a git status
+		// that is allowed to will rewrite the index.
+		now := time.Now()
+		os.Chtimes(filepath.Join(r.WorkDir, "f"), now, now)
+		r.Profile.OptionalLocks = locks
+		if _, err := r.PromptInfo(); err != nil {
+			t.Fatal(err)
+		}
+		fi, err := os.Stat(index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rewrote := fi.ModTime().After(old.Add(time.Minute)); rewrote != locks {
+			t.Errorf("OptionalLocks %v: index rewritten = %v", locks, rewrote)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package git
+
+import (
+	"fmt"
+)
+
+// PullMode tells Pull how to integrate changes from upstream.
+type PullMode int
+
+const (
+	// PullDefault honors branch.<name>.rebase and pull.rebase.
+	PullDefault PullMode = iota
+	// PullMerge always merges.
+	PullMerge
+	// PullRebase always rebases.
+	PullRebase
+)
+
+// PullOptions controls how Pull integrates changes from upstream.
+type PullOptions struct {
+	Mode PullMode
+}
+
+// PullAction describes what Pull did to the branch.
+type PullAction int
+
+const (
+	// PullUpToDate means the branch already contained everything upstream had.
+	PullUpToDate PullAction = iota
+	// PullFastForward means the branch was fast-forwarded to upstream.
+	PullFastForward
+	// PullMerged means upstream was merged into the branch.
+	PullMerged
+	// PullRebased means the branch was rebased onto upstream.
+	PullRebased
+)
+
+// PullResult describes what a Pull did.
+type PullResult struct {
+	Action PullAction
+	// Old and New are the SHAs of the branch before and after the pull.
+	Old, New string
+	// Upstream is the remote ref that was pulled from.
+	Upstream *Ref
+}
+
+// wantsRebase decides whether a pull of this branch should rebase
+// based on the git config.
+func (r *Ref) wantsRebase() bool {
+	val, found := r.r.Get("branch." + r.Name() + ".rebase")
+	if !found {
+		val, found = r.r.Get("pull.rebase")
+	}
+	if !found {
+		return false
+	}
+	switch val {
+	case "false", "no", "off", "0", "":
+		return false
+	}
+	return true
+}
+
+// Pull fetches from remote and then merges or rebases this branch
+// onto the matching remote branch.  If remote is empty, the remote
+// this branch tracks is used.
+// Whether to merge or rebase is decided by opts.Mode.
+func (r *Ref) Pull(remote string, opts PullOptions) (res *PullResult, err error) {
+	if !r.IsLocal() {
+		return nil, fmt.Errorf("%s is not a branch, cannot pull into it.", r.Path)
+	}
+	if remote == "" {
+		if remote, err = r.Tracks(); err != nil {
+			return nil, err
+		}
+	}
+	if ok, _ := r.r.Fetch([]string{remote}); !ok {
+		return nil, fmt.Errorf("Could not fetch from %s", remote)
+	}
+	r.r.ReloadRefs()
+	if err = r.Reload(); err != nil {
+		return nil, err
+	}
+	upstream, err := r.RemoteBranch(remote)
+	if err != nil {
+		return nil, err
+	}
+	res = &PullResult{Old: r.SHA, New: r.SHA, Upstream: upstream}
+	if ok, err := r.Contains(upstream); err != nil {
+		return nil, err
+	} else if ok {
+		res.Action = PullUpToDate
+		return res, nil
+	}
+	ff, err := upstream.Contains(r)
+	if err != nil {
+		return nil, err
+	}
+	rebase := opts.Mode == PullRebase ||
+		(opts.Mode == PullDefault && r.wantsRebase())
+	switch {
+	case ff:
+		res.Action = PullFastForward
+		err = r.MergeWith(upstream)
+	case rebase:
+		res.Action = PullRebased
+		err = r.RebaseOnto(upstream)
+	default:
+		res.Action = PullMerged
+		err = r.MergeWith(upstream)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res.New = r.SHA
+	return res, nil
+}
+
+// Pull pulls into the currently checked out branch from
+// the remote it tracks.
+func (r *Repo) Pull(opts PullOptions) (res *PullResult, err error) {
+	current, err := r.CurrentRef()
+	if err != nil {
+		return nil, err
+	}
+	return current.Pull("", opts)
+}
@@ -0,0 +1,117 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// PushOptions controls how Push talks to the remote.
+type PushOptions struct {
+	// SetUpstream makes the local branches track what was pushed (-u).
+	SetUpstream bool
+	// Force allows non-fast-forward updates of remote refs.
+	Force bool
+	// ForceWithLease allows non-fast-forward updates, but only if the
+	// remote refs are where our remote-tracking refs think they are.
+	ForceWithLease bool
+	// Tags pushes all local tags in addition to the refspecs.
+	Tags bool
+	// Delete deletes the remote refs named by the refspecs.
+	Delete bool
+}
+
+func (o PushOptions) args() []string {
+	args := []string{"--porcelain"}
+	if o.SetUpstream {
+		args = append(args, "--set-upstream")
+	}
+	if o.Force {
+		args = append(args, "--force")
+	}
+	if o.ForceWithLease {
+		args = append(args, "--force-with-lease")
+	}
+	if o.Tags {
+		args = append(args, "--tags")
+	}
+	if o.Delete {
+		args = append(args, "--delete")
+	}
+	return args
+}
+
+// PushResult holds what happened to a single ref during a push.
+type PushResult struct {
+	// Flag is the status flag git push --porcelain reports:
+	// ' ' for a fast-forward, '+' for a forced update, '-' for a deleted ref,
+	// '*' for a new ref, '!' for a rejected update, and '=' for an up to date ref.
+	Flag byte
+	// Src and Dst are the local and remote sides of the refspec.
+	Src, Dst string
+	// Summary is git's description of what happened.
+	Summary string
+}
+
+// Ok tests to see if the ref was pushed (or did not need to be).
+func (p PushResult) Ok() bool {
+	return p.Flag != '!'
+}
+
+func parsePush(out string) (res []PushResult) {
+	res = make([]PushResult, 0, 1)
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "\t", 3)
+		if len(parts) != 3 || len(parts[0]) != 1 {
+			// "To <url>", "Done", and other chatter.
+			continue
+		}
+		refs := strings.SplitN(parts[1], ":", 2)
+		if len(refs) != 2 {
+			continue
+		}
+		res = append(res, PushResult{
+			Flag:    parts[0][0],
+			Src:     refs[0],
+			Dst:     refs[1],
+			Summary: parts[2],
+		})
+	}
+	return res
+}
+
+// Push pushes refspecs to remote.
+// It returns the results for each ref that git tried to push,
+// even if some of them were rejected.
+func (r *Repo) Push(remote string, refspecs []string, opts PushOptions) (res []PushResult, err error) {
+	args := append(opts.args(), remote)
+	cmd, out, _ := r.Git("push", append(args, refspecs...)...)
+	if r.Auth.Credentials != nil {
+		if err = r.Auth.provideCredentials(cmd, r.remoteURL(remote, true)); err != nil {
+			return nil, err
+		}
+	}
+	err = run(cmd)
+	res = parsePush(out.String())
+	r.ReloadRefs()
+	if opts.SetUpstream {
+		r.ReloadConfig()
+	}
+	if err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// Push pushes this branch or tag to the identically-named ref at remote.
+func (r *Ref) Push(remote string, opts PushOptions) (res []PushResult, err error) {
+	if !(r.IsLocal() || r.IsTag()) {
+		return nil, fmt.Errorf("%s is not a branch or a tag, cannot push it.", r.Path)
+	}
+	refspec := r.Path + ":" + r.Path
+	if opts.Delete {
+		refspec = r.Path
+	}
+	return r.r.Push(remote, []string{refspec}, opts)
+}
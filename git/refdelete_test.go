@@ -0,0 +1,23 @@
+package git
+
+import "testing"
+
+func TestDeleteUndeletable(t *testing.T) {
+	r := newRepo(t)
+	sh(t, r, "commit", "-qm", "a", "--allow-empty")
+	sh(t, r, "update-ref", "refs/notes/x", "HEAD")
+	r.ReloadRefs()
+	sha, err := r.ResolveRev("HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"refs/notes/x", sha} {
+		ref, err := r.Ref(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ref.Delete(); err == nil {
+			t.Errorf("deleting %s did not fail", name)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package git
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReflogEntry is a single entry in the reflog of a ref.
+type ReflogEntry struct {
+	// Selector is how git names this entry, such as "master@{1}".
+	Selector string
+	// SHA is what the ref pointed at once this entry was recorded.
+	SHA string
+	// Message is what git recorded about the change,
+	// such as "commit: Fix the frobnicator".
+	Message string
+	When    time.Time
+}
+
+// Reflog returns the reflog for this ref, newest entry first.
+func (r *Ref) Reflog() (res []ReflogEntry, err error) {
+	// With --date=unix, %gd gives us the time of the entry
+	// instead of its index.
+	cmd, out, _ := r.r.Git("log", "-g", "-z", "--date=unix", "--format=%gd%x1f%H%x1f%gs", r.Path, "--")
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	res = make([]ReflogEntry, 0, 10)
+	for _, record := range strings.Split(out.String(), "\x00") {
+		if record == "" {
+			continue
+		}
+		parts := strings.Split(record, "\x1f")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("Cannot parse reflog record %q", record)
+		}
+		when := parts[0][strings.LastIndex(parts[0], "{")+1:]
+		res = append(res, ReflogEntry{
+			Selector: fmt.Sprintf("%s@{%d}", r.Name(), len(res)),
+			SHA:      parts[1],
+			Message:  parts[2],
+			When:     parseTime(strings.TrimSuffix(when, "}")),
+		})
+	}
+	return res, nil
+}
+
+type undoArgs struct {
+	confirm func(from, to string) bool
+	force   bool
+}
+
+// UndoOption modifies how ResetToReflog and Undo move a branch.
+type UndoOption func(*undoArgs)
+
+// UndoConfirm makes the reset ask confirm before moving the branch
+// from the SHA it is at to the one in the reflog.  If confirm returns
+// false, the branch is left alone and an error is returned.
+func UndoConfirm(confirm func(from, to string) bool) UndoOption {
+	return func(u *undoArgs) {
+		u.confirm = confirm
+	}
+}
+
+// UndoForce resets a checked out branch even if the working tree
+// has uncommitted changes, which will be thrown away.
+func UndoForce() UndoOption {
+	return func(u *undoArgs) {
+		u.force = true
+	}
+}
+
+// ResetToReflog moves this branch back to where it was at an entry
+// in its reflog.  selector can be a reflog index like "2", a suffix
+// like "@{2}" or "@{1.hour.ago}", or a full selector like "master@{2}".
+// If the branch is checked out, the working tree is reset along with it,
+// and the reset is refused if the working tree is not clean.
+func (r *Ref) ResetToReflog(selector string, opts ...UndoOption) (err error) {
+	if !r.IsLocal() {
+		return fmt.Errorf("%s is not a branch, cannot reset it from the reflog.", r.Path)
+	}
+	u := &undoArgs{}
+	for _, opt := range opts {
+		opt(u)
+	}
+	name := r.Name()
+	switch {
+	case strings.HasPrefix(selector, "@{"):
+		selector = name + selector
+	case !strings.Contains(selector, "@{"):
+		selector = name + "@{" + selector + "}"
+	}
+	cmd, out, _ := r.r.Git("rev-parse", "-q", "--verify", selector+"^{commit}")
+	if err = run(cmd); err != nil {
+		return err
+	}
+	target := strings.TrimSpace(out.String())
+	cmd, out, _ = r.r.Git("rev-parse", "-q", "--verify", r.Path)
+	if err = run(cmd); err != nil {
+		return err
+	}
+	current := strings.TrimSpace(out.String())
+	if target == current {
+		return nil
+	}
+	if u.confirm != nil && !u.confirm(current, target) {
+		return fmt.Errorf("Reset of %s to %s was not confirmed.", name, selector)
+	}
+	if head, err := r.r.CurrentRef(); err == nil && head != nil && head.Path == r.Path {
+		if !u.force {
+			if clean, _ := r.r.IsClean(); !clean {
+				return fmt.Errorf("%s has uncommitted changes, refusing to reset %s.", r.r.Path(), name)
+			}
+		}
+		cmd, _, _ = r.r.Git("reset", "-q", "--hard", target)
+	} else {
+		cmd, _, _ = r.r.Git("update-ref", "-m", "reset: moving to "+selector, r.Path, target, current)
+	}
+	if err = run(cmd); err != nil {
+		return err
+	}
+	r.SHA = target
+	return nil
+}
+
+// Undo moves the current branch back to where it was n changes ago,
+// according to its reflog.
+func (r *Repo) Undo(n int, opts ...UndoOption) (err error) {
+	if n < 1 {
+		return fmt.Errorf("Cannot undo %d changes.", n)
+	}
+	ref, err := r.CurrentRef()
+	if err != nil {
+		return err
+	}
+	if ref == nil || !ref.IsLocal() {
+		return fmt.Errorf("HEAD in %s is not on a branch, nothing to undo.", r.Path())
+	}
+	return ref.ResetToReflog(strconv.Itoa(n), opts...)
+}
@@ -2,21 +2,37 @@ package git
 
 import (
 	"bufio"
-	"bytes"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Ref is the basic way to point at an individual commit in Git.
 type Ref struct {
 	SHA, Path string
-	r         *Repo
+	// Type is the type of object the ref points at,
+	// usually "commit" or (for annotated tags) "tag".
+	Type string
+	// Peeled is the SHA of the commit an annotated tag points at.
+	// It is empty for everything else.
+	Peeled string
+	// Symref is the ref this one points at, if this is a symbolic ref
+	// like refs/remotes/origin/HEAD.
+	Symref string
+	// Upstream is the full name of the ref this branch tracks, if any.
+	Upstream string
+	// Subject and CommitterDate come from the commit the ref
+	// points at, or from the tag for annotated tags.
+	Subject       string
+	CommitterDate time.Time
+	r             *Repo
 }
 
 // RefSlice is a slice of pointers to Ref
@@ -65,18 +81,42 @@ func (r *Ref) Name() (res string) {
 	return k[(len(k) - 1)]
 }
 
-// Branches gets all the local branches in the repository
+// Branches gets all the local branches in the repository.
+// If the refs cannot be read, there are no branches.
 func (r *Repo) Branches() (res RefSlice) {
-	r.loadRefs()
+	refs, _ := r.loadRefs()
 	res = make(RefSlice, 0, 10)
-	for _, ref := range r.refs {
+	for path, ref := range refs {
 		if ref.IsBranch() {
-			res = append(res, ref)
+			res = append(res, refs.get(path))
 		}
 	}
 	return res
 }
 
+// BranchesContaining gets the local branches that have the commit
+// ref points at in their history.
+func (r *Repo) BranchesContaining(ref *Ref) (res RefSlice, err error) {
+	return r.listRefs("--contains="+ref.SHA, "refs/heads")
+}
+
+// RemoteBranchesContaining gets the remote tracking branches that
+// have the commit ref points at in their history.  Symbolic refs
+// like origin/HEAD are left out, so each branch is only listed once.
+func (r *Repo) RemoteBranchesContaining(ref *Ref) (res RefSlice, err error) {
+	refs, err := r.listRefs("--contains="+ref.SHA, "refs/remotes")
+	if err != nil {
+		return nil, err
+	}
+	res = make(RefSlice, 0, len(refs))
+	for _, remote := range refs {
+		if remote.Symref == "" {
+			res = append(res, remote)
+		}
+	}
+	return res, nil
+}
+
 // Branch creates a new branch starting at this ref.
 func (r *Ref) Branch(name string) (ref *Ref, err error) {
 	ref, err = r.r.makeRef("branch", name, r)
@@ -100,28 +140,121 @@ func (r *Ref) Remote() (remote string, err error) {
 }
 
 // Delete deletes a ref, if it is deletable.
-// Only branches and tags are deletable.
+// Only branches, tags, and remote refs are deletable.
 func (r *Ref) Delete() (err error) {
+	return r.DeleteWithOptions(DeleteOptions{})
+}
+
+// DeleteOptions controls how DeleteWithOptions deletes a ref.
+type DeleteOptions struct {
+	// Force deletes a branch even if it has not been merged.
+	Force bool
+}
+
+// DeleteWithOptions deletes a ref, like Delete.
+// Deleting a remote ref deletes the branch on the remote with
+// git push --delete, and then the remote ref itself.
+func (r *Ref) DeleteWithOptions(opts DeleteOptions) (err error) {
 	var c string
+	flag := "-d"
 	if r.IsRemote() {
-		return errors.New("Cannot delete a remote ref!")
+		return r.deleteRemote()
 	} else if r.IsHead() {
 		return errors.New("Cannot delete HEAD!")
 	} else if r.IsTag() {
 		c = "tag"
 	} else if r.IsBranch() {
 		c = "branch"
+		if opts.Force {
+			flag = "-D"
+		}
 	} else {
-		panic("Cannot happen!")
+		return fmt.Errorf("Cannot delete %s, it is not a branch, tag, or remote ref!", r.Path)
 	}
-	cmd, _, _ := r.r.Git(c, "-d", r.Name())
-	err = cmd.Run()
+	cmd, _, _ := r.r.Git(c, flag, r.Name())
+	err = run(cmd)
 	if err == nil {
-		delete(r.r.refs, r.Name())
+		r.r.ReloadRefs()
 	}
 	return
 }
 
+func (r *Ref) deleteRemote() (err error) {
+	// Work out which remote and branch this was fetched from
+	// by running the fetch refspecs of each remote backwards.
+	remotes := r.r.Remotes()
+	names := make([]string, 0, len(remotes))
+	for name := range remotes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var remote, branch string
+	for _, name := range names {
+		if src, ok := remotes[name].sourceRef(r.Path); ok {
+			remote, branch = name, src
+			break
+		}
+	}
+	if remote == "" || branch == "HEAD" || strings.HasSuffix(branch, "/HEAD") {
+		return fmt.Errorf("Cannot delete %s!", r.Path)
+	}
+	if _, err = r.r.Push(remote, []string{branch}, PushOptions{Delete: true}); err != nil {
+		// If the branch is already gone from the remote, all that
+		// is left to do is to clean up after it.
+		if !gitErrorMatches(err, []string{"remote ref does not exist"}) {
+			return err
+		}
+	}
+	// git push cleans up the remote ref when it can, but make sure.
+	cmd, _, _ := r.r.Git("update-ref", "-d", r.Path)
+	if err = run(cmd); err != nil {
+		return err
+	}
+	r.r.ReloadRefs()
+	return nil
+}
+
+// Rename renames this branch to newName.  git moves the
+// branch.<name>.* config along with it, so the new name tracks
+// whatever the old one did.  Unless force is true, git will
+// refuse to replace an existing branch.
+func (r *Ref) Rename(newName string, force bool) (err error) {
+	if !r.IsLocal() {
+		return fmt.Errorf("%s is not a branch, cannot rename it.", r.Path)
+	}
+	flag := "-m"
+	if force {
+		flag = "-M"
+	}
+	cmd, _, _ := r.r.Git("branch", flag, r.Name(), newName)
+	if err = run(cmd); err != nil {
+		return err
+	}
+	r.Path = "refs/heads/" + newName
+	r.r.ReloadRefs()
+	r.r.ReloadConfig()
+	return nil
+}
+
+// Copy copies this branch to a new branch named newName, along with
+// its branch.<name>.* config, and returns the new branch.
+func (r *Ref) Copy(newName string) (res *Ref, err error) {
+	if !r.IsLocal() {
+		return nil, fmt.Errorf("%s is not a branch, cannot copy it.", r.Path)
+	}
+	cmd, _, _ := r.r.Git("branch", "-c", r.Name(), newName)
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	r.r.ReloadRefs()
+	r.r.ReloadConfig()
+	refs, err := r.r.loadRefs()
+	if err != nil {
+		return nil, err
+	}
+	return refs.get("refs/heads/" + newName), nil
+}
+
 // Tracks returns the remote that this ref is configred to track, if any.
 // If this ref does not track anything, then an error is returned.
 func (r *Ref) Tracks() (remote string, err error) {
@@ -132,7 +265,7 @@ func (r *Ref) Tracks() (remote string, err error) {
 	if remoteExists {
 		return remote, nil
 	}
-	return "", fmt.Errorf("%s does not track a remote")
+	return "", fmt.Errorf("%s does not track a remote", r.Path)
 }
 
 // RemoteBranch returns the remote ref corresponding to this branch for a
@@ -142,14 +275,31 @@ func (r *Ref) RemoteBranch(remote string) (res *Ref, err error) {
 	if !r.IsLocal() {
 		return nil, fmt.Errorf("%s is not a branch, cannot find remote tracking branch.\n", r.Path)
 	}
-	remoteName := "refs/remotes/" + remote + "/" + r.Name()
-	res, found := r.r.refs[remoteName]
-	if !found {
+	remoteName, ok := r.r.trackingRef(remote, r.Path)
+	if !ok {
+		return nil, fmt.Errorf("%s is not fetched from %s\n", r.Path, remote)
+	}
+	refs, err := r.r.loadRefs()
+	if err != nil {
+		return nil, err
+	}
+	if res = refs.get(remoteName); res == nil {
 		return nil, fmt.Errorf("%s has no remote branch at %s\n", r.Path, remote)
 	}
 	return res, nil
 }
 
+// trackingRef works out which remote tracking ref the branch at path
+// would be fetched into from remote.  If remote is not one of ours,
+// it assumes the standard refs/remotes/<remote>/ layout.
+func (r *Repo) trackingRef(remote, path string) (res string, ok bool) {
+	rm, err := r.Remote(remote)
+	if err != nil {
+		return "refs/remotes/" + remote + "/" + strings.TrimPrefix(path, "refs/heads/"), true
+	}
+	return rm.TrackingRef(path)
+}
+
 // TrackedRef returns  the remote ref that this ref tracks, if any.
 func (r *Ref) TrackedRef() (res *Ref, err error) {
 	remote, err := r.Tracks()
@@ -166,16 +316,32 @@ func (r *Ref) Reload() (err error) {
 	if r.IsHead() || r.IsRaw() {
 		return nil
 	}
-	refPath := filepath.Join(r.r.GitDir, r.Path)
-	sha, err := ioutil.ReadFile(refPath)
-	if err != nil {
+	// Ask git, since the ref may be packed, or live in
+	// a different git directory than ours in a worktree.
+	cmd, out, _ := r.r.Git("rev-parse", "-q", "--verify", r.Path)
+	if err = run(cmd); err != nil {
 		return err
 	}
-	buf := bytes.NewBuffer(sha)
-	r.SHA = strings.TrimSpace(buf.String())
+	r.SHA = strings.TrimSpace(out.String())
 	return nil
 }
 
+// UpdateTo points this ref at sha, without touching the index or
+// working tree.  The update only happens if the ref still points
+// where it did when it was loaded, so that concurrent updates are
+// not lost.
+func (r *Ref) UpdateTo(sha string) (err error) {
+	if r.IsRaw() {
+		return fmt.Errorf("Cannot update raw ref %s", r.Path)
+	}
+	cmd, _, _ := r.r.Git("update-ref", "-m", "update to "+sha, r.Path, sha, r.SHA)
+	if err = run(cmd); err != nil {
+		return err
+	}
+	r.r.ReloadRefs()
+	return r.Reload()
+}
+
 // Contains tests to see if other is reachable in the commit
 // history leading up to this ref.
 func (r *Ref) Contains(other *Ref) (bool, error) {
@@ -183,34 +349,110 @@ func (r *Ref) Contains(other *Ref) (bool, error) {
 	if r.SHA == other.SHA {
 		return true, nil
 	}
-	// If other's revision graph has revs that are not in our revision
-	// graph, then we do not contain other.
-	cmd, out, _ := r.r.Git("rev-list", other.SHA, fmt.Sprintf("^%s", r.SHA))
-	if err := cmd.Run(); err != nil {
+	r.r.autoCommitGraph()
+	// merge-base --is-ancestor exits 0 if other is an ancestor of us,
+	// and 1 if it is not.  Anything else is a real failure.
+	cmd, _, _ := r.r.Git("merge-base", "--is-ancestor", other.SHA, r.SHA)
+	err := run(cmd)
+	var gitErr *GitError
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.As(err, &gitErr) && gitErr.ExitCode == 1:
+		return false, nil
+	}
+	return false, err
+}
+
+// AheadBehind counts the commits this ref has that other does not
+// (ahead), and the commits other has that this ref does not (behind).
+func (r *Ref) AheadBehind(other *Ref) (ahead, behind int, err error) {
+	r.r.autoCommitGraph()
+	res, err := r.r.RevList(RevListOptions{
+		Revs:      []string{r.SHA + "..." + other.SHA},
+		Count:     true,
+		LeftRight: true,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return res.LeftCount, res.RightCount, nil
+}
+
+// UpstreamDivergence counts how far this branch is ahead of and
+// behind the remote branch it tracks.
+func (r *Ref) UpstreamDivergence() (ahead, behind int, err error) {
+	upstream, err := r.TrackedRef()
+	if err != nil {
+		return 0, 0, err
+	}
+	return r.AheadBehind(upstream)
+}
+
+// Parents gets the parents of the commit this ref points at, as raw
+// refs, in the order git recorded them.  Root commits have no parents.
+func (r *Ref) Parents() (res RefSlice, err error) {
+	cmd, out, _ := r.r.Git("rev-parse", r.SHA+"^@")
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	res = make(RefSlice, 0, 2)
+	for _, sha := range strings.Fields(out.String()) {
+		res = append(res, &Ref{Path: sha, SHA: sha, r: r.r})
+	}
+	return res, nil
+}
+
+// IsMergeCommit tests to see if the commit this ref points at
+// has more than one parent.
+func (r *Ref) IsMergeCommit() (bool, error) {
+	parents, err := r.Parents()
+	if err != nil {
 		return false, err
 	}
-	// If there is no output, then all of other's revs are members of
-	// our revision graph, and we contain other.
-	return (out.Len() == 0), nil
+	return len(parents) > 1, nil
+}
+
+// MergeBase finds the best common ancestor of a and b, which is
+// where a merge of the two would start from.
+func (r *Repo) MergeBase(a, b *Ref) (res *Ref, err error) {
+	cmd, out, _ := r.Git("merge-base", a.SHA, b.SHA)
+	if err = run(cmd); err != nil {
+		var gitErr *GitError
+		if errors.As(err, &gitErr) && gitErr.ExitCode == 1 && gitErr.Stderr == "" {
+			return nil, fmt.Errorf("%s and %s have no common ancestor", a.Path, b.Path)
+		}
+		return nil, err
+	}
+	sha := strings.TrimSpace(out.String())
+	return &Ref{Path: sha, SHA: sha, r: r}, nil
 }
 
 // CurrentRef gets the ref that HEAD is pointing at.
 // It handles cases where HEAD is pointing at a symbolic ref
 // (a branch, tag, or remote ref), and where HEAD is pointing at a
 // raw SHA1.
+// If HEAD points at a branch that has no commits yet, CurrentRef
+// returns a Ref for that branch with an empty SHA, along with ErrUnborn.
 func (r *Repo) CurrentRef() (current *Ref, err error) {
-	r.loadRefs()
+	refs, err := r.loadRefs()
+	if err != nil {
+		return nil, err
+	}
 	cmd, out, _ := r.Git("symbolic-ref", "HEAD")
-	err = cmd.Run()
+	err = run(cmd)
 	if err == nil {
 		// If we did not get an error, then out has the symbolic ref
 		// of the branch we are on.
 		refname := strings.TrimSpace(out.String())
-		return r.refs[refname], nil
+		if current = refs.get(refname); current == nil {
+			return &Ref{Path: refname, r: r}, ErrUnborn
+		}
+		return current, nil
 	}
 	// Otherwise, we need to rev-parse HEAD to get what we are currently on.
 	cmd, out, _ = r.Git("rev-parse", "HEAD")
-	if err = cmd.Run(); err != nil {
+	if err = run(cmd); err != nil {
 		// Something Bad has happened.
 		return nil, err
 	}
@@ -219,13 +461,30 @@ func (r *Repo) CurrentRef() (current *Ref, err error) {
 	return &Ref{Path: refname, SHA: refname, r: r}, nil
 }
 
+// ErrUnborn is returned by CurrentRef when HEAD points at
+// a branch that does not have any commits yet.
+var ErrUnborn = errors.New("HEAD points at a branch with no commits")
+
+// IsUnborn tests to see if HEAD points at a branch that
+// has no commits yet, as it does right after Init.
+func (r *Repo) IsUnborn() bool {
+	cmd, _, _ := r.Git("rev-parse", "-q", "--verify", "HEAD")
+	return cmd.Run() != nil
+}
+
+// HasCommits tests to see if there are any commits in the repository at all.
+func (r *Repo) HasCommits() bool {
+	cmd, out, _ := r.Git("rev-list", "-n", "1", "--all")
+	return cmd.Run() == nil && strings.TrimSpace(out.String()) != ""
+}
+
 // Equals checks to see if this ref is the same as another ref.
 // Refs are equal if they have the same path and the same SHA.
 func (r *Ref) Equals(other *Ref) bool {
 	return r.Path == other.Path && r.SHA == other.SHA && r.r == other.r
 }
 
-func mergeRebaseWrapper(op string, head, target *Ref, doer *exec.Cmd, undoer func() error) (err error) {
+func mergeRebaseWrapper(op string, head, target *Ref, doer *exec.Cmd, undoer func(error) error) (err error) {
 	// if r contains target, no need to do anything.
 	ok, err := head.Contains(target)
 	if err != nil {
@@ -235,7 +494,7 @@ func mergeRebaseWrapper(op string, head, target *Ref, doer *exec.Cmd, undoer fun
 		return nil
 	}
 	if !head.IsLocal() {
-		return fmt.Errorf("%s is not a branch, cannot %s it!\n", op, head.Path)
+		return fmt.Errorf("%s is not a branch, cannot %s it!\n", head.Path, op)
 	}
 	current, err := head.r.CurrentRef()
 	if err != nil {
@@ -247,11 +506,13 @@ func mergeRebaseWrapper(op string, head, target *Ref, doer *exec.Cmd, undoer fun
 		}
 		defer current.Checkout()
 	}
-	if doer.Run() == nil {
+	if err = run(doer); err != nil {
+		err = undoer(err)
+	}
+	if err == nil {
 		head.Reload()
-		return nil
 	}
-	return undoer()
+	return err
 }
 
 // RebaseOnto rebases a ref onto target.
@@ -259,10 +520,21 @@ func mergeRebaseWrapper(op string, head, target *Ref, doer *exec.Cmd, undoer fun
 // If the rebase fails for any reason, the rebase will be aborted and the
 // error output of the rebase will be return as an error.
 func (r *Ref) RebaseOnto(target *Ref) (err error) {
-	cmd, out, errOut := r.r.Git("rebase", "-q", target.SHA, r.Name())
-	undoer := func() (err error) {
+	return r.RebaseOntoWithResolver(target, nil)
+}
+
+// RebaseOntoWithResolver rebases a ref onto target like RebaseOnto,
+// but calls resolver to resolve any conflicts that come up instead of
+// giving up.  The rebase is still aborted if resolver returns an error.
+func (r *Ref) RebaseOntoWithResolver(target *Ref, resolver ConflictResolver) (err error) {
+	cmd, _, _ := r.r.Git("rebase", "-q", target.SHA, r.Name())
+	undoer := func(err error) error {
+		if resolver != nil {
+			if err = r.r.resolveConflicts("rebase", resolver, err); err == nil {
+				return nil
+			}
+		}
 		// The rebase failed.  Unwind it, by force if needed.
-		err = fmt.Errorf("%s\n%s\n", out.String(), errOut.String())
 		cmd, _, _ := r.r.Git("rebase", "--abort")
 		if cmd.Run() == nil {
 			// We unwound successfully.
@@ -282,10 +554,21 @@ func (r *Ref) RebaseOnto(target *Ref) (err error) {
 // If the merge succeeds, this method will return nil.
 // Otherwise the merge will be aborted and the error output of the merge will be returned as an error.
 func (r *Ref) MergeWith(target *Ref) (err error) {
-	cmd, out, errOut := r.r.Git("merge", "-q", target.SHA, r.Name())
-	undoer := func() (err error) {
+	return r.MergeWithResolver(target, nil)
+}
+
+// MergeWithResolver merges this ref into the target like MergeWith,
+// but calls resolver to resolve any conflicts instead of giving up.
+// The merge is still aborted if resolver returns an error.
+func (r *Ref) MergeWithResolver(target *Ref, resolver ConflictResolver) (err error) {
+	cmd, _, _ := r.r.Git("merge", "-q", target.SHA, r.Name())
+	undoer := func(err error) error {
+		if resolver != nil {
+			if err = r.r.resolveConflicts("merge", resolver, err); err == nil {
+				return nil
+			}
+		}
 		// The merge failed.  Unwind it, by force if needed.
-		err = fmt.Errorf("%s\n%s\n", out.String(), errOut.String())
 		cmd, _, _ := r.r.Git("merge", "--abort")
 		if cmd.Run() == nil {
 			// We unwound successfully.
@@ -301,11 +584,12 @@ func (r *Ref) MergeWith(target *Ref) (err error) {
 }
 
 // HasRef tests to see if a ref exists.
-// It must be passed a full ref name beginning with "refs/"
+// It must be passed a full ref name beginning with "refs/".
+// If the refs cannot be read, no ref exists.
 func (r *Repo) HasRef(ref string) bool {
-	r.loadRefs()
-	_, err := r.refs[ref]
-	return err
+	refs, _ := r.loadRefs()
+	_, found := refs[ref]
+	return found
 }
 
 // HasRemoteRef checks to see if this branch has a matching branch at a given remote.
@@ -313,7 +597,8 @@ func (r *Ref) HasRemoteRef(remote string) (ok bool) {
 	if !r.IsLocal() {
 		return false
 	}
-	return r.r.HasRef("refs/remotes/" + remote + "/" + r.Name())
+	remoteName, ok := r.r.trackingRef(remote, r.Path)
+	return ok && r.r.HasRef(remoteName)
 }
 
 // TrackRemote forces a local ref (which should be a branch)
@@ -334,32 +619,132 @@ func (r *Ref) TrackRemote(remote string) (err error) {
 		return nil
 	}
 	if branchRemoteExists || branchMergeExists {
-		r.r.maybeKillSection(section)
+		if err = r.r.maybeKillSection(section); err != nil {
+			return err
+		}
+	}
+	if err = r.r.Set(section+".remote", remote); err != nil {
+		return err
+	}
+	return r.r.Set(section+".merge", r.Path)
+}
+
+// SetUpstream makes this branch track upstream, which must be
+// a remote ref or another branch that exists.
+func (r *Ref) SetUpstream(upstream *Ref) (err error) {
+	if !r.IsLocal() {
+		return fmt.Errorf("%s is not a branch, we cannot track it.", r.Path)
+	}
+	if !(upstream.IsRemote() || upstream.IsLocal()) {
+		return fmt.Errorf("%s is not a branch or a remote ref, it cannot be tracked.", upstream.Path)
 	}
-	r.r.Set(section+".remote", remote)
-	r.r.Set(section+".merge", r.Path)
+	cmd, _, _ := r.r.Git("branch", "--set-upstream-to="+upstream.Path, r.Name())
+	if err = run(cmd); err != nil {
+		return err
+	}
+	r.r.ReloadConfig()
+	r.r.ReloadRefs()
 	return nil
 }
 
-// Cat returns a Reader that will contain the contents of the
+// SetUpstreamRemote fetches from remote, and makes this branch track
+// the identically-named branch there.  If there is no such branch and
+// create is true, this branch is pushed to create it first.
+func (r *Ref) SetUpstreamRemote(remote string, create bool) (err error) {
+	if !r.IsLocal() {
+		return fmt.Errorf("%s is not a branch, we cannot track it.", r.Path)
+	}
+	if ok, _ := r.r.Fetch([]string{remote}); !ok {
+		return fmt.Errorf("Could not fetch from %s", remote)
+	}
+	upstream, err := r.RemoteBranch(remote)
+	if err != nil {
+		if !create {
+			return err
+		}
+		if _, err = r.r.Push(remote, []string{r.Path + ":" + r.Path}, PushOptions{}); err != nil {
+			return err
+		}
+		r.r.ReloadRefs()
+		if upstream, err = r.RemoteBranch(remote); err != nil {
+			return err
+		}
+	}
+	return r.SetUpstream(upstream)
+}
+
+// UnsetUpstream makes this branch stop tracking anything.
+func (r *Ref) UnsetUpstream() (err error) {
+	if !r.IsLocal() {
+		return fmt.Errorf("%s is not a branch, it does not track anything.", r.Path)
+	}
+	cmd, _, _ := r.r.Git("branch", "--unset-upstream", r.Name())
+	if err = run(cmd); err != nil {
+		return err
+	}
+	r.r.ReloadConfig()
+	r.r.ReloadRefs()
+	return nil
+}
+
+// catReader streams a blob out of git cat-file.
+type catReader struct {
+	out  io.ReadCloser
+	cmd  *exec.Cmd
+	done bool
+}
+
+func (c *catReader) Read(p []byte) (n int, err error) {
+	n, err = c.out.Read(p)
+	if err == io.EOF && !c.done {
+		c.done = true
+		if waitErr := wait(c.cmd); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// Close stops git, if the blob has not been read all the way through.
+func (c *catReader) Close() error {
+	if c.done {
+		return nil
+	}
+	c.done = true
+	c.cmd.Process.Kill()
+	c.cmd.Wait()
+	return nil
+}
+
+// Cat returns a ReadCloser that streams the contents of the
 // file at fullpath in this ref, if it exists.
 // Otherwise, it will return an error.
-func (r *Ref) Cat(fullpath string) (out io.Reader, err error) {
-	cmd, lsout, _ := r.r.Git("ls-tree", "--full-tree", fullpath)
-	err = cmd.Run()
+// The contents are not buffered, so large files can be read
+// without loading them into memory.  Close the ReadCloser
+// once done with it.
+func (r *Ref) Cat(fullpath string) (out io.ReadCloser, err error) {
+	cmd, lsout, _ := r.r.Git("ls-tree", "-z", "-l", "--full-tree", r.SHA, "--", fullpath)
+	err = run(cmd)
 	if err != nil {
 		return nil, err
 	}
-	if lsout.Len() == 0 {
-		return nil, fmt.Errorf("%s is not present in %s", fullpath, r.r.Path())
+	entry, ok := parseTreeEntry(strings.TrimSuffix(lsout.String(), "\x00"))
+	if !ok {
+		return nil, fmt.Errorf("%s is not present in %s", fullpath, r.Path)
+	}
+	if entry.Type != "blob" {
+		return nil, fmt.Errorf("%s is not a file in %s", fullpath, r.Path)
 	}
-	parts := strings.Split(lsout.String(), " ")
-	if parts[1] != "blob" {
-		return nil, fmt.Errorf("%s is not a file in %s", fullpath, r.r.Path())
+	cmd, _, _ = r.r.Git("cat-file", "blob", entry.SHA)
+	cmd.Stdout = nil
+	pipe, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
 	}
-	shaname := strings.Split(parts[2], "\t")
-	cmd, out, _ = r.r.Git("cat-file", "blob", shaname[0])
-	return out, cmd.Run()
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &catReader{out: pipe, cmd: cmd}, nil
 }
 
 // Ref returns a ref for the passed name, or an error.
@@ -368,23 +753,113 @@ func (r *Ref) Cat(fullpath string) (out io.Reader, err error) {
 //   branch names, tags, remote tracking branches,
 //   and raw SHA1s.
 func (r *Repo) Ref(name string) (res *Ref, err error) {
-	r.loadRefs()
+	refs, err := r.loadRefs()
+	if err != nil {
+		return nil, err
+	}
 	for _, prefix := range []string{"", "refs/heads/", "refs/tags/", "refs/remotes/"} {
 		refname := prefix + name
-		if res = r.refs[refname]; res != nil {
+		if res = refs.get(refname); res != nil {
 			return res, nil
 		}
 	}
 	// hmmm... it is not a symbolic ref.  See if it is a raw ref.
-	cmd, _, _ := r.Git("rev-parse", "-q", "--verify", name)
-	if cmd.Run() == nil {
-		return &Ref{Path: name, SHA: name, r: r}, nil
+	if sha, err := r.ResolveRev(name); err == nil {
+		return &Ref{Path: sha, SHA: sha, r: r}, nil
 	}
 	return nil, fmt.Errorf("No ref for %s", name)
 }
 
-func (r *Repo) makeRef(reftype, name string, base interface{}) (ref *Ref, err error) {
-	r.loadRefs()
+// ResolveRev gets the full SHA of the object that spec names.
+// spec can be anything git understands, like "HEAD~2",
+// "v1.0^{commit}", or an abbreviated SHA.
+func (r *Repo) ResolveRev(spec string) (sha string, err error) {
+	cmd, out, _ := r.Git("rev-parse", "--verify", "--end-of-options", spec)
+	if err = run(cmd); err != nil {
+		return "", fmt.Errorf("%s does not name anything in %s: %w", spec, r.Path(), err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// AbbrevLength gets how many characters git abbreviates SHAs to in
+// this repository.  It honors core.abbrev, including its default of
+// "auto", which picks a length based on how many objects there are.
+func (r *Repo) AbbrevLength() (n int, err error) {
+	// Ask git to abbreviate the empty tree, which it always knows about.
+	cmd, out, _ := r.GitWithInput(strings.NewReader(""), "hash-object", "-t", "tree", "--stdin")
+	if err = run(cmd); err != nil {
+		return 0, err
+	}
+	cmd, out, _ = r.Git("rev-parse", "--short", strings.TrimSpace(out.String()))
+	if err = run(cmd); err != nil {
+		return 0, err
+	}
+	return len(strings.TrimSpace(out.String())), nil
+}
+
+// ShortSHA abbreviates the SHA of this ref to at least n characters,
+// using more if they are needed to keep it unique.  If n is 0,
+// the length comes from core.abbrev.
+func (r *Ref) ShortSHA(n int) string {
+	arg := "--short"
+	if n > 0 {
+		arg += "=" + strconv.Itoa(n)
+	}
+	cmd, out, _ := r.r.Git("rev-parse", arg, r.SHA)
+	if run(cmd) == nil {
+		return strings.TrimSpace(out.String())
+	}
+	// git could not do it, so just chop the SHA.
+	if n <= 0 {
+		n = 7
+	}
+	if n > len(r.SHA) {
+		return r.SHA
+	}
+	return r.SHA[:n]
+}
+
+// checkBase makes sure that base names exactly one thing that a
+// branch or tag can be created from.
+func (r *Repo) checkBase(reftype, base string) (err error) {
+	if !isSHA(base) {
+		refs, err := r.loadRefs()
+		if err != nil {
+			return err
+		}
+		candidates := []string{}
+		for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/"} {
+			if refs[prefix+base] != nil {
+				candidates = append(candidates, prefix+base)
+			}
+		}
+		if len(candidates) > 1 {
+			return &AmbiguousRefError{Name: base, Candidates: candidates}
+		}
+	}
+	verify := base
+	if reftype == "branch" {
+		verify += "^{commit}"
+	}
+	cmd, _, _ := r.Git("rev-parse", "-q", "--verify", verify)
+	if err = run(cmd); err != nil {
+		return &BadBaseError{Base: base, Err: err}
+	}
+	return nil
+}
+
+// makeRef creates a branch or tag.  args are passed to git branch or
+// git tag before the name, and passing --force lets an existing
+// branch or tag be replaced.
+func (r *Repo) makeRef(reftype, name string, base interface{}, args ...string) (ref *Ref, err error) {
+	refs, err := r.loadRefs()
+	if err != nil {
+		return nil, err
+	}
+	force := false
+	for _, arg := range args {
+		force = force || arg == "--force"
+	}
 	var path string
 	switch reftype {
 	case "branch":
@@ -396,37 +871,46 @@ func (r *Repo) makeRef(reftype, name string, base interface{}) (ref *Ref, err er
 	}
 	if name == "HEAD" {
 		return nil, errors.New("Cannot create a branch named HEAD.")
-	} else if r.refs[path] != nil {
+	} else if refs[path] != nil && !force {
 		return nil, errors.New(name + " already exists.")
-	} else {
-		switch i := base.(type) {
-		case *Ref:
-			cmd, _, _ := r.Git(reftype, name, i.Name())
-			err = cmd.Run()
-		case string:
-			cmd, _, _ := r.Git(reftype, name, i)
-			err = cmd.Run()
-		default:
-			return nil, fmt.Errorf("Unknown type %v for base", i)
-		}
-		if err != nil {
+	}
+	var target string
+	switch i := base.(type) {
+	case *Ref:
+		// Use the full name, so it cannot be mistaken for anything else.
+		target = i.Path
+	case *Commit:
+		target = i.SHA
+	case string:
+		if err = r.checkBase(reftype, i); err != nil {
 			return nil, err
 		}
+		target = i
+	default:
+		return nil, fmt.Errorf("Unknown type %v for base", i)
 	}
-	r.refs = nil
-	r.loadRefs()
-	return r.refs[path], nil
+	cmd, _, _ := r.Git(reftype, append(args, name, target)...)
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	r.ReloadRefs()
+	if refs, err = r.loadRefs(); err != nil {
+		return nil, err
+	}
+	return refs.get(path), nil
 }
 
 // Branch creates a branch with the given name based on whatever is passed for base.
-// base can be either a Ref type of the name of a ref, in which case it must actually exist.
+// base can be a Ref, a Commit, or the name of a ref or a raw SHA, which must
+// actually exist.  Names that could mean more than one ref are refused with
+// an AmbiguousRefError, and names that do not resolve with a BadBaseError.
 func (r *Repo) Branch(name string, base interface{}) (ref *Ref, err error) {
 	ref, err = r.makeRef("branch", name, base)
 	return
 }
 
 // Tag creates a tag with the given name based on whatever is passed for base.
-// base can be either a Ref type of the name of a ref, in which case it must actually exist.
+// base is handled the same way as it is for Branch.
 func (r *Repo) Tag(name string, base interface{}) (ref *Ref, err error) {
 	ref, err = r.makeRef("tag", name, base)
 	return
@@ -434,22 +918,25 @@ func (r *Repo) Tag(name string, base interface{}) (ref *Ref, err error) {
 
 // Checkout checks this ref out.
 func (r *Ref) Checkout() (err error) {
+	return r.CheckoutWithOptions(CheckoutOptions{})
+}
+
+// CheckoutWithOptions checks this ref (or just some paths from it) out.
+func (r *Ref) CheckoutWithOptions(opts CheckoutOptions) (err error) {
 	var ref string
 	if r.IsLocal() || r.IsTag() || r.IsRemote() {
 		ref = r.Name()
 	} else {
 		ref = r.SHA
 	}
-	cmd, _, _ := r.r.Git("checkout", "-q", ref)
-	err = cmd.Run()
-	return
+	return r.r.CheckoutWithOptions(ref, opts)
 }
 
 // Cherry will return an array of Refs that correspond to
 // unique changes from base to r
 func (r *Ref) Cherry(base *Ref) (refs []*Ref, err error) {
 	cmd, out, _ := r.r.Git("cherry", base.SHA, r.SHA)
-	if err = cmd.Run(); err != nil {
+	if err = run(cmd); err != nil {
 		return nil, err
 	}
 	refs = make([]*Ref, 0, 10)
@@ -464,62 +951,393 @@ func (r *Ref) Cherry(base *Ref) (refs []*Ref, err error) {
 	return refs, nil
 }
 
-// CherryLog will return an array of strings that contain the output from
-// git log --cherry-pick --right-only --no-merges --oneline base.SHA...r.SHA
-func (r *Ref) CherryLog(base *Ref) (log []string, err error) {
+// CherryLogEntry holds one commit that CherryLog found.
+type CherryLogEntry struct {
+	SHA     string
+	Subject string
+	Author  Signature
+	// Equivalent is true if an equivalent change already exists in base.
+	Equivalent bool
+}
+
+// cherryFormat is the --format that CherryLog parses.
+const cherryFormat = "%m%x1f%H%x1f%an%x1f%ae%x1f%at%x1f%s"
+
+// CherryLog will return the non-merge commits in r that are not in base,
+// as found by git log --cherry-mark --right-only --no-merges base.SHA...r.SHA
+// Commits whose changes are already in base are included
+// with Equivalent set.
+func (r *Ref) CherryLog(base *Ref) (log []CherryLogEntry, err error) {
 	cmd, out, _ := r.r.Git("log",
-		"--cherry-pick",
+		"--cherry-mark",
 		"--right-only",
 		"--no-merges",
-		"--oneline",
+		"-z",
+		"--format="+cherryFormat,
 		base.SHA+"..."+r.SHA)
-	if err = cmd.Run(); err != nil {
+	if err = run(cmd); err != nil {
 		return nil, err
 	}
-	log = make([]string, 0, 10)
+	log = make([]CherryLogEntry, 0, 10)
 	scanner := bufio.NewScanner(out)
+	scanner.Split(scanNUL)
 	for scanner.Scan() {
-		log = append(log, scanner.Text())
+		parts := strings.Split(scanner.Text(), "\x1f")
+		if len(parts) != 6 {
+			return nil, fmt.Errorf("Cannot parse cherry record %q", scanner.Text())
+		}
+		log = append(log, CherryLogEntry{
+			SHA:        parts[1],
+			Subject:    parts[5],
+			Author:     Signature{Name: parts[2], Email: parts[3], When: parseTime(parts[4])},
+			Equivalent: parts[0] == "=",
+		})
 	}
 	return log, nil
 }
 
 // Checkout checks out a ref by name.
 func (r *Repo) Checkout(ref string) (err error) {
-	cmd, _, _ := r.Git("checkout", "-q", ref)
-	err = cmd.Run()
-	return
+	return r.CheckoutWithOptions(ref, CheckoutOptions{})
+}
+
+// CheckoutOptions controls how CheckoutWithOptions checks things out.
+type CheckoutOptions struct {
+	// Force throws away local changes that are in the way.
+	Force bool
+	// Detach checks out the ref with a detached HEAD,
+	// even if it is a branch.
+	Detach bool
+	// NewBranch creates a branch with this name at the ref and checks
+	// it out.  ResetBranch lets it replace an existing branch (-B).
+	NewBranch   string
+	ResetBranch bool
+	// Paths checks out just these paths from the ref, leaving
+	// HEAD alone.
+	Paths []string
+}
+
+func (o CheckoutOptions) args() []string {
+	args := []string{"-q"}
+	if o.Force {
+		args = append(args, "--force")
+	}
+	if o.Detach {
+		args = append(args, "--detach")
+	}
+	if o.NewBranch != "" {
+		if o.ResetBranch {
+			args = append(args, "-B", o.NewBranch)
+		} else {
+			args = append(args, "-b", o.NewBranch)
+		}
+	}
+	return args
+}
+
+// CheckoutWithOptions checks out a ref (or just some paths from it) by name.
+// If git refuses because local changes or untracked files are in
+// the way, the error is a *CheckoutError listing them.
+func (r *Repo) CheckoutWithOptions(ref string, opts CheckoutOptions) (err error) {
+	args := append(opts.args(), ref)
+	if len(opts.Paths) > 0 {
+		args = append(append(args, "--"), opts.Paths...)
+	}
+	cmd, _, _ := r.Git("checkout", args...)
+	if err = run(cmd); err != nil {
+		return newCheckoutError(ref, err)
+	}
+	if opts.NewBranch != "" {
+		r.ReloadRefs()
+	}
+	return nil
+}
+
+// SwitchOptions controls how Switch switches branches.
+type SwitchOptions struct {
+	// Create creates the branch, starting at StartPoint, before
+	// switching to it.  ForceCreate also replaces an existing branch.
+	Create, ForceCreate bool
+	// Orphan creates a new branch with no history and an empty
+	// working tree (apart from untracked files).
+	Orphan bool
+	// StartPoint is where Create starts the branch.  If empty, it is HEAD.
+	StartPoint string
+	// Detach switches to the commit StartPoint (or branch) names,
+	// with a detached HEAD.
+	Detach bool
+	// Discard throws away local changes that are in the way.
+	Discard bool
+}
+
+func (o SwitchOptions) args(branch string) []string {
+	args := []string{"-q"}
+	if o.Discard {
+		args = append(args, "--discard-changes")
+	}
+	switch {
+	case o.Orphan:
+		return append(args, "--orphan", branch)
+	case o.ForceCreate:
+		args = append(args, "-C", branch)
+	case o.Create:
+		args = append(args, "-c", branch)
+	case o.Detach:
+		args = append(args, "--detach")
+		if o.StartPoint == "" {
+			args = append(args, branch)
+		}
+	default:
+		args = append(args, branch)
+	}
+	if o.StartPoint != "" {
+		args = append(args, o.StartPoint)
+	}
+	return args
 }
 
-func (r *Repo) loadRefs() {
-	if r.refs != nil {
-		return
+// Switch switches to branch, like git switch.  Unlike Checkout,
+// it will not check out anything but a branch unless Detach is set.
+// If git refuses because local changes or untracked files are in
+// the way, the error is a *CheckoutError listing them.
+func (r *Repo) Switch(branch string, opts SwitchOptions) (err error) {
+	cmd, _, _ := r.Git("switch", opts.args(branch)...)
+	if err = run(cmd); err != nil {
+		return newCheckoutError(branch, err)
+	}
+	r.ReloadRefs()
+	return nil
+}
+
+// RestoreOptions controls what Restore restores, and where from.
+type RestoreOptions struct {
+	// Source is the ref to restore the paths from.  If empty,
+	// the working tree is restored from the index, and the
+	// index from HEAD.
+	Source string
+	// Staged restores the index, and Worktree the working tree.
+	// If neither is set, only the working tree is restored.
+	Staged, Worktree bool
+}
+
+func (o RestoreOptions) args() []string {
+	args := []string{"-q"}
+	if o.Source != "" {
+		args = append(args, "--source="+o.Source)
+	}
+	if o.Staged {
+		args = append(args, "--staged")
+	}
+	if o.Worktree {
+		args = append(args, "--worktree")
+	}
+	return args
+}
+
+// Restore restores paths in the working tree and/or the index,
+// like git restore, without moving HEAD.
+func (r *Repo) Restore(paths []string, opts RestoreOptions) (err error) {
+	if len(paths) == 0 {
+		return errors.New("No paths to restore!")
+	}
+	cmd, _, _ := r.Git("restore", append(append(opts.args(), "--"), paths...)...)
+	return run(cmd)
+}
+
+// refFormat is the format loadRefs asks for-each-ref for.
+// parseRef knows the order of the fields.
+const refFormat = "--format=%(objectname)%1f%(refname)%1f%(objecttype)%1f%(*objectname)%1f" +
+	"%(symref)%1f%(upstream)%1f%(committerdate:unix)%1f%(*committerdate:unix)%1f%(subject)"
+
+// parseRef makes a Ref out of a line of for-each-ref output in refFormat.
+func parseRef(r *Repo, line string) *Ref {
+	parts := strings.SplitN(line, "\x1f", 9)
+	if len(parts) != 9 {
+		return nil
+	}
+	ref := &Ref{
+		SHA:      parts[0],
+		Path:     parts[1],
+		Type:     parts[2],
+		Peeled:   parts[3],
+		Symref:   parts[4],
+		Upstream: parts[5],
+		Subject:  parts[8],
+		r:        r,
+	}
+	// Annotated tags have no committer, so use the one from
+	// the commit they point at.
+	date := parts[6]
+	if date == "" {
+		date = parts[7]
+	}
+	if date != "" {
+		ref.CommitterDate = parseTime(date)
+	}
+	return ref
+}
+
+// loadRefs returns the cached refs, loading them if needed.
+// The RefMap it returns is never changed once it is loaded, so it can
+// be read without holding the lock, but the Refs in it must be copied
+// with get before they are handed out.
+func (r *Repo) loadRefs() (RefMap, error) {
+	r.mu.Lock()
+	refs, gen := r.refs, r.refsGen
+	r.mu.Unlock()
+	if refs != nil {
+		return refs, nil
 	}
 	res := make(RefMap)
-	cmd, out, err := r.Git("show-ref")
-	if cmd.Run() != nil {
-		panic(err.String())
+	cmd, out, _ := r.Git("for-each-ref", refFormat)
+	if err := run(cmd); err != nil {
+		return nil, err
 	}
 	scanner := bufio.NewScanner(out)
 	for scanner.Scan() {
-		parts := strings.SplitN(strings.TrimSpace(scanner.Text()), " ", 2)
-		ref := &Ref{parts[0], parts[1], r}
-		res[ref.Path] = ref
+		if ref := parseRef(r, scanner.Text()); ref != nil {
+			res[ref.Path] = ref
+		}
+	}
+	// Don't cache what we loaded if the refs were reloaded
+	// while we were loading them, since it may be out of date.
+	r.mu.Lock()
+	if r.refsGen == gen {
+		r.refs = res
 	}
-	r.refs = res
+	r.mu.Unlock()
+	return res, nil
 }
 
-// Refs returns a slice of all the refs
+// get returns a copy of the ref at path, or nil if there is no such ref.
+// Handing out copies lets callers Reload their Refs without
+// stepping on anyone else.
+func (m RefMap) get(path string) *Ref {
+	ref, found := m[path]
+	if !found {
+		return nil
+	}
+	res := *ref
+	return &res
+}
+
+// Refs returns a slice of all the refs.
+// If the refs cannot be read, the slice is empty.
 func (r *Repo) Refs() (res RefSlice) {
 	r.ReloadRefs()
-	res = make(RefSlice, 0, 10)
-	for _, v := range r.refs {
-		res = append(res, v)
+	refs, _ := r.loadRefs()
+	res = make(RefSlice, 0, len(refs))
+	for path := range refs {
+		res = append(res, refs.get(path))
 	}
 	return res
 }
 
 // ReloadRefs will load all the refs lazily.
 func (r *Repo) ReloadRefs() {
+	r.mu.Lock()
 	r.refs = nil
+	r.refsGen++
+	r.mu.Unlock()
+}
+
+// refNamespace returns the namespace that RefSummary files refname under.
+func refNamespace(refname string) string {
+	parts := strings.SplitN(refname, "/", 4)
+	switch {
+	case len(parts) < 3 || parts[0] != "refs":
+		return refname
+	case parts[1] == "remotes" && len(parts) == 4:
+		return "remotes/" + parts[2]
+	}
+	return parts[1]
+}
+
+// RefSummary counts the refs in each namespace of the repository.
+// Namespaces are things like "heads", "tags", "notes", "pull",
+// and "remotes/<remote>".  The refs are counted as git lists them,
+// so this is cheap even for repositories with enormous numbers of refs.
+func (r *Repo) RefSummary() (res map[string]int, err error) {
+	cmd, _, _ := r.Git("for-each-ref", "--format=%(refname)")
+	cmd.Stdout = nil
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	res = make(map[string]int)
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		res[refNamespace(scanner.Text())]++
+	}
+	if err = wait(cmd); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// listRefs runs for-each-ref with args, which filter and limit
+// what it lists, and returns the refs it found.
+func (r *Repo) listRefs(args ...string) (res RefSlice, err error) {
+	cmd, out, _ := r.Git("for-each-ref", append([]string{refFormat}, args...)...)
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	res = make(RefSlice, 0)
+	for _, line := range strings.Split(out.String(), "\n") {
+		if ref := parseRef(r, line); ref != nil {
+			res = append(res, ref)
+		}
+	}
+	return res, nil
+}
+
+// ErrStopRefs can be returned by the function passed to EachRef
+// to stop walking the refs without EachRef returning an error.
+var ErrStopRefs = errors.New("stop walking refs")
+
+// EachRef calls fn with each ref that matches pattern, as git streams
+// them out of for-each-ref, without loading all the refs into memory.
+// An empty pattern matches every ref.  If fn returns an error, EachRef
+// stops and returns it, unless it is ErrStopRefs.
+// The Refs passed to fn are not cached, so use this instead of Refs
+// for repositories with huge numbers of refs.
+func (r *Repo) EachRef(pattern string, fn func(*Ref) error) (err error) {
+	args := []string{refFormat}
+	if pattern != "" {
+		args = append(args, pattern)
+	}
+	cmd, _, _ := r.Git("for-each-ref", args...)
+	cmd.Stdout = nil
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(out)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		ref := parseRef(r, scanner.Text())
+		if ref == nil {
+			continue
+		}
+		if err = fn(ref); err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			if err == ErrStopRefs {
+				return nil
+			}
+			return err
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	return wait(cmd)
 }
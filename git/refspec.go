@@ -0,0 +1,160 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Refspec says which refs a fetch or push moves, and where they end
+// up, like "+refs/heads/*:refs/remotes/origin/*".
+type Refspec struct {
+	// Src is the ref or pattern on the side the refs come from,
+	// and Dst is where they go.  Patterns have a single *,
+	// which matches any part of a ref name, slashes included.
+	Src, Dst string
+	// Force lets refs be updated even when it is not a fast-forward.
+	Force bool
+	// Negative is set for refspecs that start with ^, which
+	// keep the refs Src matches from being moved.
+	Negative bool
+}
+
+// ParseRefspec parses a refspec as git writes them.
+func ParseRefspec(spec string) (res Refspec, err error) {
+	switch {
+	case strings.HasPrefix(spec, "+"):
+		res.Force = true
+		spec = spec[1:]
+	case strings.HasPrefix(spec, "^"):
+		res.Negative = true
+		spec = spec[1:]
+	}
+	parts := strings.SplitN(spec, ":", 2)
+	res.Src = parts[0]
+	if len(parts) == 2 {
+		res.Dst = parts[1]
+	}
+	srcGlob, dstGlob := strings.Count(res.Src, "*"), strings.Count(res.Dst, "*")
+	switch {
+	case res.Negative && res.Dst != "":
+		return res, fmt.Errorf("Negative refspec %s cannot have a destination", spec)
+	case srcGlob > 1 || dstGlob > 1:
+		return res, fmt.Errorf("Refspec %s has more than one * on a side", spec)
+	case res.Dst != "" && srcGlob != dstGlob:
+		return res, fmt.Errorf("Refspec %s has a * on only one side", spec)
+	}
+	return res, nil
+}
+
+func (s Refspec) String() string {
+	res := s.Src
+	if s.Dst != "" {
+		res += ":" + s.Dst
+	}
+	switch {
+	case s.Force:
+		return "+" + res
+	case s.Negative:
+		return "^" + res
+	}
+	return res
+}
+
+// refspecMatch matches name against pattern, and returns what the * matched.
+func refspecMatch(pattern, name string) (matched string, ok bool) {
+	star := strings.Index(pattern, "*")
+	if star < 0 {
+		return "", pattern == name
+	}
+	prefix, suffix := pattern[:star], pattern[star+1:]
+	if len(name) < len(prefix)+len(suffix) ||
+		!strings.HasPrefix(name, prefix) ||
+		!strings.HasSuffix(name, suffix) {
+		return "", false
+	}
+	return name[len(prefix) : len(name)-len(suffix)], true
+}
+
+// Matches tests to see if the ref name matches Src.
+func (s Refspec) Matches(name string) bool {
+	_, ok := refspecMatch(s.Src, name)
+	return ok
+}
+
+// Map rewrites the ref name, which must match Src, to where
+// it ends up on the Dst side.  For a fetch refspec, that turns
+// a branch on the remote into its remote tracking branch.
+func (s Refspec) Map(name string) (res string, ok bool) {
+	if s.Negative || s.Dst == "" {
+		return "", false
+	}
+	matched, ok := refspecMatch(s.Src, name)
+	if !ok {
+		return "", false
+	}
+	return strings.Replace(s.Dst, "*", matched, 1), true
+}
+
+// Reverse swaps Src and Dst, so that Map goes the other way.
+func (s Refspec) Reverse() Refspec {
+	s.Src, s.Dst = s.Dst, s.Src
+	return s
+}
+
+// mapRefspecs maps name through specs, the way git does when it
+// fetches: the first refspec that maps name wins, unless a negative
+// refspec matches it.
+func mapRefspecs(specs []string, name string) (res string, ok bool) {
+	parsed := make([]Refspec, 0, len(specs))
+	for _, spec := range specs {
+		refspec, err := ParseRefspec(spec)
+		if err != nil {
+			continue
+		}
+		if refspec.Negative && refspec.Matches(name) {
+			return "", false
+		}
+		parsed = append(parsed, refspec)
+	}
+	for _, refspec := range parsed {
+		if res, ok = refspec.Map(name); ok {
+			return res, true
+		}
+	}
+	return "", false
+}
+
+// TrackingRef gets the remote tracking ref that fetching from this
+// remote would store the ref name (like "refs/heads/main") in,
+// according to the fetch refspecs of the remote.
+func (rm *Remote) TrackingRef(name string) (res string, ok bool) {
+	return mapRefspecs(rm.FetchRefspecs, name)
+}
+
+// sourceRef is the reverse of TrackingRef: it gets the ref on this
+// remote that fetching stores in the remote tracking ref name.
+func (rm *Remote) sourceRef(name string) (res string, ok bool) {
+	parsed := make([]Refspec, 0, len(rm.FetchRefspecs))
+	for _, spec := range rm.FetchRefspecs {
+		if refspec, err := ParseRefspec(spec); err == nil {
+			parsed = append(parsed, refspec)
+		}
+	}
+	for _, refspec := range parsed {
+		if refspec.Negative {
+			continue
+		}
+		if res, ok = refspec.Reverse().Map(name); !ok {
+			continue
+		}
+		for _, negative := range parsed {
+			if negative.Negative && negative.Matches(res) {
+				ok = false
+			}
+		}
+		if ok {
+			return res, true
+		}
+	}
+	return "", false
+}
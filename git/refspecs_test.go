@@ -0,0 +1,90 @@
+package git
+
+import "testing"
+
+func TestParseRefspec(t *testing.T) {
+	for _, tc := range []struct {
+		spec  string
+		want  Refspec
+		fails bool
+	}{
+		{"+refs/heads/*:refs/remotes/origin/*", Refspec{Src: "refs/heads/*", Dst: "refs/remotes/origin/*", Force: true}, false},
+		{"refs/heads/main:refs/heads/main", Refspec{Src: "refs/heads/main", Dst: "refs/heads/main"}, false},
+		{"^refs/heads/tmp/*", Refspec{Src: "refs/heads/tmp/*", Negative: true}, false},
+		{"refs/tags/*", Refspec{Src: "refs/tags/*"}, false},
+		{":refs/heads/gone", Refspec{Dst: "refs/heads/gone"}, false},
+		{"^refs/heads/a:refs/heads/b", Refspec{}, true},
+		{"refs/*/*:refs/x/*", Refspec{}, true},
+		{"refs/heads/*:refs/remotes/origin/main", Refspec{}, true},
+	} {
+		got, err := ParseRefspec(tc.spec)
+		if (err != nil) != tc.fails {
+			t.Errorf("ParseRefspec(%q) error = %v", tc.spec, err)
+			continue
+		}
+		if tc.fails {
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseRefspec(%q) = %+v, want %+v", tc.spec, got, tc.want)
+		}
+		if got.String() != tc.spec {
+			t.Errorf("ParseRefspec(%q).String() = %q", tc.spec, got.String())
+		}
+	}
+}
+
+func TestRefspecMap(t *testing.T) {
+	for _, tc := range []struct {
+		spec, name, want string
+		ok               bool
+	}{
+		{"+refs/heads/*:refs/remotes/origin/*", "refs/heads/main", "refs/remotes/origin/main", true},
+		{"+refs/heads/*:refs/remotes/origin/*", "refs/heads/a/b", "refs/remotes/origin/a/b", true},
+		{"+refs/heads/*:refs/remotes/origin/*", "refs/tags/v1", "", false},
+		{"refs/heads/main:refs/remotes/origin/main", "refs/heads/main", "refs/remotes/origin/main", true},
+		{"refs/heads/main:refs/remotes/origin/main", "refs/heads/maint", "", false},
+		{"refs/heads/*-rc:refs/rc/*", "refs/heads/v1-rc", "refs/rc/v1", true},
+		{"refs/heads/*-rc:refs/rc/*", "refs/heads/-r", "", false},
+		{"refs/tags/*", "refs/tags/v1", "", false},
+		{"^refs/heads/*", "refs/heads/main", "", false},
+	} {
+		refspec, err := ParseRefspec(tc.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := refspec.Map(tc.name); got != tc.want || ok != tc.ok {
+			t.Errorf("%s.Map(%q) = %q, %v", tc.spec, tc.name, got, ok)
+		}
+		if !tc.ok {
+			continue
+		}
+		if got, ok := refspec.Reverse().Map(tc.want); got != tc.name || !ok {
+			t.Errorf("%s.Reverse().Map(%q) = %q, %v", tc.spec, tc.want, got, ok)
+		}
+	}
+}
+
+func TestRemoteRefMapping(t *testing.T) {
+	rm := &Remote{FetchRefspecs: []string{
+		"^refs/heads/tmp/*",
+		"+refs/heads/*:refs/remotes/origin/*",
+		"+refs/pull/*/head:refs/remotes/pr/*",
+	}}
+	for _, tc := range []struct {
+		remote, tracking string
+		ok               bool
+	}{
+		{"refs/heads/main", "refs/remotes/origin/main", true},
+		{"refs/heads/feature/x", "refs/remotes/origin/feature/x", true},
+		{"refs/pull/12/head", "refs/remotes/pr/12", true},
+		{"refs/heads/tmp/x", "refs/remotes/origin/tmp/x", false},
+	} {
+		if got, ok := rm.TrackingRef(tc.remote); ok != tc.ok || (ok && got != tc.tracking) {
+			t.Errorf("TrackingRef(%q) = %q, %v", tc.remote, got, ok)
+		}
+		if got, ok := rm.sourceRef(tc.tracking); ok != tc.ok || (ok && got != tc.remote) {
+			t.Errorf("sourceRef(%q) = %q, %v", tc.tracking, got, ok)
+		}
+	}
+}
@@ -1,27 +1,179 @@
 package git
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
-// RemoteMap holds our map of remote names -> remote specifiers.
-type RemoteMap map[string]string
+// Remote is a remote repository, as configured in remote.<name>.*
+type Remote struct {
+	Name string
+	// FetchURL is the URL the remote is fetched from.
+	FetchURL string
+	// pushURLs are the push URLs set for the remote, if any.
+	pushURLs []string
+	// FetchRefspecs and PushRefspecs say which refs are fetched
+	// and pushed, and where they end up.
+	FetchRefspecs, PushRefspecs []string
+	// Mirror is set if pushes to the remote mirror every ref.
+	Mirror bool
+	r      *Repo
+}
+
+// RemoteMap holds our map of remote names -> remotes.
+type RemoteMap map[string]*Remote
 
-// Remotes gets our list of remotes by parsing the git config.
+// Remotes gets our remotes by parsing the git config.
 func (r *Repo) Remotes() RemoteMap {
 	res := make(RemoteMap)
-	r.readConfig()
-	for k, v := range r.cfg {
-		parts := strings.Split(k, ".")
-		if parts[0] == "remote" && parts[2] == "url" {
-			res[parts[1]] = v
+	// The config cache only keeps the last value of each variable,
+	// and remotes can have several URLs and refspecs.
+	cmd, out, _ := r.Git("config", "-z", "--get-regexp", `^remote\.`)
+	if cmd.Run() != nil {
+		return res
+	}
+	for _, entry := range strings.Split(out.String(), "\x00") {
+		parts := strings.SplitN(entry, "\n", 2)
+		key := parts[0]
+		val := ""
+		if len(parts) == 2 {
+			val = parts[1]
+		}
+		// Remote names can have dots in them.
+		first, last := strings.Index(key, "."), strings.LastIndex(key, ".")
+		if first == last {
+			continue
+		}
+		name := key[first+1 : last]
+		remote := res[name]
+		if remote == nil {
+			remote = &Remote{Name: name, r: r}
+			res[name] = remote
+		}
+		switch key[last+1:] {
+		case "url":
+			remote.FetchURL = val
+		case "pushurl":
+			remote.pushURLs = append(remote.pushURLs, val)
+		case "fetch":
+			remote.FetchRefspecs = append(remote.FetchRefspecs, val)
+		case "push":
+			remote.PushRefspecs = append(remote.PushRefspecs, val)
+		case "mirror":
+			switch strings.ToLower(val) {
+			case "", "true", "yes", "on", "1":
+				remote.Mirror = true
+			}
+		}
+	}
+	// Sections that only have other settings are not remotes.
+	for name, remote := range res {
+		if remote.FetchURL == "" {
+			delete(res, name)
 		}
 	}
 	return res
 }
 
+// Remote gets the remote called name.
+func (r *Repo) Remote(name string) (res *Remote, err error) {
+	if res = r.Remotes()[name]; res == nil {
+		return nil, fmt.Errorf("%s does not have a remote named %s", r.Path(), name)
+	}
+	return res, nil
+}
+
+// PushURLs gets the URLs that pushes to this remote go to.
+// Unless push URLs have been added, that is just FetchURL.
+func (rm *Remote) PushURLs() []string {
+	if len(rm.pushURLs) == 0 {
+		return []string{rm.FetchURL}
+	}
+	return append([]string{}, rm.pushURLs...)
+}
+
+// AddPushURL makes pushes to this remote go to url as well.
+// Once a push URL has been added, pushes no longer go to FetchURL,
+// so to push to it along with some mirrors, add it as a push URL too.
+func (rm *Remote) AddPushURL(url string) (err error) {
+	cmd, _, _ := rm.r.Git("remote", "set-url", "--add", "--push", rm.Name, url)
+	if err = run(cmd); err != nil {
+		return err
+	}
+	rm.r.ReloadConfig()
+	rm.pushURLs = append(rm.pushURLs, url)
+	return nil
+}
+
+// DeletePushURL stops pushes to this remote from going to url.
+// Once the last push URL is deleted, pushes go to FetchURL again.
+func (rm *Remote) DeletePushURL(url string) (err error) {
+	cmd, _, _ := rm.r.Git("remote", "set-url", "--delete", "--push", rm.Name, "^"+regexp.QuoteMeta(url)+"$")
+	if err = run(cmd); err != nil {
+		return err
+	}
+	rm.r.ReloadConfig()
+	kept := make([]string, 0, len(rm.pushURLs))
+	for _, pushURL := range rm.pushURLs {
+		if pushURL != url {
+			kept = append(kept, pushURL)
+		}
+	}
+	rm.pushURLs = kept
+	return nil
+}
+
+// Fetch fetches updates from this remote, and returns what
+// happened to each ref that changed.
+func (rm *Remote) Fetch(opts FetchOptions) (updates []FetchUpdate, err error) {
+	ok := make(chan FetchStatus, 1)
+	rm.r.fetchOne(context.Background(), rm.Name, opts, ok)
+	status := <-ok
+	return status.Updates, status.Err
+}
+
+// Push pushes refspecs to this remote.  If refspecs is empty,
+// what gets pushed is decided by the push refspecs of the remote
+// and push.default.
+func (rm *Remote) Push(refspecs []string, opts PushOptions) (res []PushResult, err error) {
+	return rm.r.Push(rm.Name, refspecs, opts)
+}
+
+// Prune removes the remote tracking branches of this remote
+// whose branches no longer exist on the remote, and returns the
+// short names (like "origin/gone") of the ones it removed.
+// With dryRun, it returns the ones it would remove, and leaves them be.
+func (rm *Remote) Prune(dryRun bool) (pruned []string, err error) {
+	args := []string{"prune"}
+	if dryRun {
+		args = append(args, "--dry-run")
+	}
+	cmd, out, _ := rm.r.Git("remote", append(args, rm.Name)...)
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	rm.r.ReloadRefs()
+	pruned = []string{}
+	// * [pruned] origin/gone, or * [would prune] origin/gone
+	for _, line := range strings.Split(out.String(), "\n") {
+		line = strings.TrimSpace(line)
+		for _, prefix := range []string{"* [pruned] ", "* [would prune] "} {
+			if strings.HasPrefix(line, prefix) {
+				pruned = append(pruned, strings.TrimPrefix(line, prefix))
+			}
+		}
+	}
+	return pruned, nil
+}
+
 // HasRemote tests to see if this repository has a specific remote by url.
 func (r *Repo) HasRemote(remote string) (ok bool) {
 	_, ok = r.Get("remote." + remote + ".url")
@@ -31,15 +183,15 @@ func (r *Repo) HasRemote(remote string) (ok bool) {
 // AddRemote adds a new remote.
 func (r *Repo) AddRemote(name, url string) (err error) {
 	remotes := r.Remotes()
-	if remotes[name] != "" {
+	if remotes[name] != nil {
 		msg := fmt.Sprintf("%s already has a remote named %s", r.Path(), name)
 		return errors.New(msg)
 	}
 	cmd, _, _ := r.Git("remote", "add", name, url)
-	if err = cmd.Run(); err != nil {
+	if err = run(cmd); err != nil {
 		return err
 	}
-	r.cfg = nil
+	r.ReloadConfig()
 	return nil
 }
 
@@ -52,63 +204,208 @@ func (r *Repo) RenameRemote(old, nuevo string) (err error) {
 		return fmt.Errorf("%s already exists!\n", nuevo)
 	}
 	cmd, _, _ := r.Git("remote", "rename", old, nuevo)
-	if err = cmd.Run(); err != nil {
+	if err = run(cmd); err != nil {
 		return err
 	}
-	r.cfg = nil
+	r.ReloadConfig()
 	return nil
 }
 
 // ZapRemote destroys a remote.
 func (r *Repo) ZapRemote(name string) (err error) {
 	remotes := r.Remotes()
-	if remotes[name] == "" {
+	if remotes[name] == nil {
 		msg := fmt.Sprintf("%s does not have a remote named %s", r.Path(), name)
 		return errors.New(msg)
 	}
 	cmd, _, _ := r.Git("remote", "rm", name)
-	if err = cmd.Run(); err != nil {
+	if err = run(cmd); err != nil {
 		return err
 	}
-	r.cfg = nil
+	r.ReloadConfig()
 	return nil
 }
 
 // SetRemoteURL sets a new URL for a remote.
 func (r *Repo) SetRemoteURL(name, url string) (err error) {
 	remotes := r.Remotes()
-	if remotes[name] == "" {
+	if remotes[name] == nil {
 		return fmt.Errorf("%s does not have a remote named %s\n", r.Path(), name)
 	}
 	cmd, _, _ := r.Git("remote", "set-url", name, url)
-	if err = cmd.Run(); err != nil {
+	if err = run(cmd); err != nil {
 		return err
 	}
-	r.cfg = nil
+	r.ReloadConfig()
 	return nil
 }
 
 // ProbeURL probes a URL to see if there is a git repository there.
-// We assume that there is a ref named 'refs/heads/master' in the remote.
+// An empty repository counts as found.
 func ProbeURL(url string) (found bool, err error) {
-	cmd, _, _ := Git("ls-remote", url, "refs/heads/master")
-	err = cmd.Run()
-	if err != nil {
+	return ProbeURLWithAuth(url, Auth{})
+}
+
+// ProbeURLWithAuth is ProbeURL, authenticating to url with auth.
+func ProbeURLWithAuth(url string, auth Auth) (found bool, err error) {
+	cmd, _, _ := Git("ls-remote", url)
+	auth.apply(cmd)
+	if err = auth.provideCredentials(cmd, url); err != nil {
+		return false, err
+	}
+	if err = run(cmd); err != nil {
 		return false, err
 	}
 	return true, nil
 }
 
+// RemoteDefaultBranch gets the name of the branch that HEAD points
+// at in the repository at url, which is the branch a clone
+// would check out.
+func RemoteDefaultBranch(url string) (branch string, err error) {
+	return RemoteDefaultBranchWithAuth(url, Auth{})
+}
+
+// RemoteDefaultBranchWithAuth is RemoteDefaultBranch, authenticating to url with auth.
+func RemoteDefaultBranchWithAuth(url string, auth Auth) (branch string, err error) {
+	cmd, out, _ := Git("ls-remote", "--symref", url, "HEAD")
+	auth.apply(cmd)
+	if err = auth.provideCredentials(cmd, url); err != nil {
+		return "", err
+	}
+	if err = run(cmd); err != nil {
+		return "", err
+	}
+	// ref: refs/heads/main <TAB> HEAD
+	for _, line := range strings.Split(out.String(), "\n") {
+		parts := strings.SplitN(line, "\t", 2)
+		if len(parts) == 2 && parts[1] == "HEAD" && strings.HasPrefix(parts[0], "ref: ") {
+			return strings.TrimPrefix(strings.TrimPrefix(parts[0], "ref: "), "refs/heads/"), nil
+		}
+	}
+	return "", fmt.Errorf("%s does not have a default branch", url)
+}
+
+// LsRemoteOptions filters and orders what LsRemote returns.
+type LsRemoteOptions struct {
+	// Heads and Tags limit the output to branches and tags.
+	// If both are set, both branches and tags are returned.
+	Heads, Tags bool
+	// Patterns limits the output to refs whose names match one of these patterns.
+	Patterns []string
+	// Sort is passed as --sort, e.g. "version:refname" or "-version:refname".
+	Sort string
+}
+
+func (o LsRemoteOptions) args(url string) []string {
+	args := []string{}
+	if o.Heads {
+		args = append(args, "--heads")
+	}
+	if o.Tags {
+		args = append(args, "--tags")
+	}
+	if o.Sort != "" {
+		args = append(args, "--sort="+o.Sort)
+	}
+	args = append(args, url)
+	return append(args, o.Patterns...)
+}
+
+// RemoteRef is a ref as advertised by a remote repository.
+type RemoteRef struct {
+	SHA, Name string
+}
+
+func parseLsRemote(out *bytes.Buffer) (res []RemoteRef) {
+	res = make([]RemoteRef, 0, 10)
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "\t", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		res = append(res, RemoteRef{SHA: parts[0], Name: parts[1]})
+	}
+	return res
+}
+
+// LsRemote lists the refs that the repository at url advertises.
+func LsRemote(url string, opts LsRemoteOptions) (res []RemoteRef, err error) {
+	return LsRemoteWithAuth(url, opts, Auth{})
+}
+
+// LsRemoteWithAuth is LsRemote, authenticating to url with auth.
+func LsRemoteWithAuth(url string, opts LsRemoteOptions, auth Auth) (res []RemoteRef, err error) {
+	cmd, out, _ := Git("ls-remote", opts.args(url)...)
+	auth.apply(cmd)
+	if err = auth.provideCredentials(cmd, url); err != nil {
+		return nil, err
+	}
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	return parseLsRemote(out), nil
+}
+
+// LsRemote lists the refs that remote advertises.
+// remote can be the name of one of our remotes or a URL.
+func (r *Repo) LsRemote(remote string, opts LsRemoteOptions) (res []RemoteRef, err error) {
+	cmd, out, _ := r.Git("ls-remote", opts.args(remote)...)
+	if r.Auth.Credentials != nil {
+		if err = r.Auth.provideCredentials(cmd, r.remoteURL(remote, false)); err != nil {
+			return nil, err
+		}
+	}
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	return parseLsRemote(out), nil
+}
+
+// PruneRemotesOptions controls how careful PruneRemotesWithOptions is.
+type PruneRemotesOptions struct {
+	// DryRun finds the remotes that would be pruned,
+	// without removing them.
+	DryRun bool
+	// Attempts is how many times a remote is probed before it is
+	// decided that there is nothing there, so that a network blip
+	// does not get a remote pruned.  Less than 1 means 1.
+	Attempts int
+	// RetryDelay is how long to wait between attempts.
+	RetryDelay time.Duration
+	// Confirm, if not nil, is called for each remote that is about
+	// to be pruned, with the error the last probe failed with, if any.
+	// The remote is only pruned if it returns true.
+	Confirm func(remote *Remote, err error) bool
+}
+
 // PruneRemotes prunes remotes that do not point at an actual git repository.
 func (r *Repo) PruneRemotes() (res map[string]bool) {
+	return r.PruneRemotesWithOptions(PruneRemotesOptions{})
+}
+
+// PruneRemotesWithOptions prunes remotes that do not point at an
+// actual git repository, like PruneRemotes.  The result says which
+// remotes were pruned, or would have been with DryRun.
+func (r *Repo) PruneRemotesWithOptions(opts PruneRemotesOptions) (res map[string]bool) {
 	res = make(map[string]bool)
-	for remote, url := range r.Remotes() {
-		found, _ := ProbeURL(url)
-		if !found && r.ZapRemote(remote) == nil {
-			res[remote] = true
-		} else {
-			res[remote] = false
+	for name, remote := range r.Remotes() {
+		var found bool
+		var err error
+		for attempt := 0; attempt < opts.Attempts || attempt == 0; attempt++ {
+			if attempt > 0 {
+				time.Sleep(opts.RetryDelay)
+			}
+			if found, err = ProbeURLWithAuth(remote.FetchURL, r.Auth); found {
+				break
+			}
+		}
+		prune := !found && (opts.Confirm == nil || opts.Confirm(remote, err))
+		if prune && !opts.DryRun {
+			prune = r.ZapRemote(name) == nil
 		}
+		res[name] = prune
 	}
 	return res
 }
@@ -117,17 +414,334 @@ func (r *Repo) PruneRemotes() (res map[string]bool) {
 type FetchStatus struct {
 	Ok     bool
 	Remote string
+	// Err is why the fetch failed, if it did.  It is the error from
+	// the context if the fetch was cancelled or timed out.
+	Err error
+	// Stderr is what git fetch printed, and Elapsed is how long it took.
+	Stderr  string
+	Elapsed time.Duration
+	// Updates are what happened to each ref that the fetch changed,
+	// or tried to.
+	Updates []FetchUpdate
+}
+
+// FetchUpdate holds what happened to a single ref during a fetch.
+type FetchUpdate struct {
+	// Flag is the status flag git fetch reports:
+	// ' ' for a fast-forward, '+' for a forced update, '-' for a pruned
+	// ref, 't' for an updated tag, '*' for a new ref, '!' for a rejected
+	// update, and '=' for an up to date ref.
+	Flag byte
+	// From is the name of the ref on the remote, as git printed it,
+	// and To is the full name of the local ref it was fetched into.
+	// From is empty for pruned refs.  From, Summary, and Reason are
+	// also empty with git 2.41 and later, which report their updates
+	// with --porcelain.
+	From, To string
+	// OldSHA and NewSHA are what To pointed at before and after the
+	// fetch.  OldSHA is empty for new refs, and NewSHA for pruned ones.
+	OldSHA, NewSHA string
+	// Summary is git's description of what happened, like
+	// "[new branch]" or "1a2b3c4..5d6e7f8", and Reason is why,
+	// for forced and rejected updates.
+	Summary, Reason string
+}
+
+// Ok tests to see if the ref was fetched (or did not need to be).
+func (u FetchUpdate) Ok() bool {
+	return u.Flag != '!'
+}
+
+// <flag> SP <summary> SP+ <from> SP+ -> SP <to> [SP+ (<reason>)]
+var fetchUpdateRE = regexp.MustCompile(`^ (.) (\[[^\]]+\]|[0-9a-f]+\.\.\.?[0-9a-f]+) +(\S+) +-> (\S+)(?: +\((.*)\))?$`)
+
+// refRules are the ways git tries to expand a short ref name,
+// in the order it tries them.
+var refRules = []string{"%s", "refs/%s", "refs/tags/%s", "refs/heads/%s", "refs/remotes/%s", "refs/remotes/%s/HEAD"}
+
+// parseFetch parses the ref updates git fetch printed on stderr.
+// To is left as git printed it, and no SHAs are filled in.
+func parseFetch(out string) (res []FetchUpdate) {
+	res = make([]FetchUpdate, 0)
+	for _, line := range strings.Split(out, "\n") {
+		m := fetchUpdateRE.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		update := FetchUpdate{Flag: m[1][0], Summary: m[2], From: m[3], To: m[4], Reason: m[5]}
+		if update.From == "(none)" {
+			// Pruned refs are not on the remote any more.
+			update.From = ""
+		}
+		res = append(res, update)
+	}
+	return res
+}
+
+// parseFetchPorcelain parses what git fetch --porcelain printed:
+// <flag> SP <old-sha> SP <new-sha> SP <local-ref>
+func parseFetchPorcelain(out string) (res []FetchUpdate) {
+	res = make([]FetchUpdate, 0)
+	for _, line := range strings.Split(out, "\n") {
+		if len(line) < 2 {
+			continue
+		}
+		fields := strings.Fields(line[2:])
+		if len(fields) != 3 {
+			continue
+		}
+		update := FetchUpdate{Flag: line[0], OldSHA: fields[0], NewSHA: fields[1], To: fields[2]}
+		// All zeros means the ref did not exist.
+		if strings.Trim(update.OldSHA, "0") == "" {
+			update.OldSHA = ""
+		}
+		if strings.Trim(update.NewSHA, "0") == "" {
+			update.NewSHA = ""
+		}
+		res = append(res, update)
+	}
+	return res
+}
+
+// fillFetchUpdates fills in the full names and SHAs of updates from
+// parseFetch.  The SHAs of updated refs come from what git printed,
+// and new refs are looked up.  before holds what the refs that could
+// have been pruned pointed at before the fetch.
+func (r *Repo) fillFetchUpdates(updates []FetchUpdate, before map[string]string) {
+	names := []string{}
+	abbrevs := []string{}
+	for _, update := range updates {
+		for _, rule := range refRules {
+			names = append(names, fmt.Sprintf(rule, update.To))
+		}
+		if parts := strings.SplitN(strings.Replace(update.Summary, "...", "..", 1), "..", 2); len(parts) == 2 {
+			abbrevs = append(abbrevs, parts...)
+		}
+	}
+	after := r.refSHAs(names...)
+	shas := r.expandSHAs(abbrevs)
+	for i := range updates {
+		update := &updates[i]
+		for _, rule := range refRules {
+			name := fmt.Sprintf(rule, update.To)
+			if _, found := after[name]; found {
+				update.To = name
+				break
+			}
+			if _, found := before[name]; found {
+				update.To = name
+				break
+			}
+		}
+		if parts := strings.SplitN(strings.Replace(update.Summary, "...", "..", 1), "..", 2); len(parts) == 2 {
+			update.OldSHA, update.NewSHA = shas[parts[0]], shas[parts[1]]
+			continue
+		}
+		update.OldSHA, update.NewSHA = before[update.To], after[update.To]
+		if update.Flag == '!' {
+			// Rejected updates leave the ref alone.
+			update.OldSHA = update.NewSHA
+		}
+	}
+}
+
+// expandSHAs maps abbreviated SHAs to the full SHAs of the objects they name.
+func (r *Repo) expandSHAs(abbrevs []string) map[string]string {
+	res := make(map[string]string)
+	if len(abbrevs) == 0 {
+		return res
+	}
+	cmd, out, _ := r.GitWithInput(strings.NewReader(strings.Join(abbrevs, "\n")+"\n"), "cat-file", "--batch-check=%(objectname)")
+	if run(cmd) != nil {
+		return res
+	}
+	// git answers each line in order, with "<abbrev> missing"
+	// for anything it cannot find.
+	for i, line := range strings.Split(out.String(), "\n") {
+		if i < len(abbrevs) && isSHA(line) {
+			res[abbrevs[i]] = line
+		}
+	}
+	return res
+}
+
+// refSHAs maps the full names of the refs matching patterns (as
+// understood by git for-each-ref) to their SHAs, without going
+// through the ref cache.  With no patterns, it maps nothing.
+func (r *Repo) refSHAs(patterns ...string) map[string]string {
+	res := make(map[string]string)
+	if len(patterns) == 0 {
+		return res
+	}
+	cmd, out, _ := r.Git("for-each-ref", append([]string{"--format=%(objectname) %(refname)"}, patterns...)...)
+	if run(cmd) != nil {
+		return res
+	}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if parts := strings.SplitN(line, " ", 2); len(parts) == 2 {
+			res[parts[1]] = parts[0]
+		}
+	}
+	return res
+}
+
+// prunable gets the for-each-ref patterns that cover the refs
+// fetching from remote with opts could prune.
+func (r *Repo) prunable(remote string, opts FetchOptions) (res []string) {
+	if !(opts.Prune || opts.PruneTags) {
+		return nil
+	}
+	if opts.PruneTags {
+		res = append(res, "refs/tags")
+	}
+	rm, err := r.Remote(remote)
+	if err != nil {
+		return res
+	}
+	for _, spec := range rm.FetchRefspecs {
+		refspec, err := ParseRefspec(spec)
+		if err != nil || refspec.Negative || refspec.Dst == "" {
+			continue
+		}
+		res = append(res, strings.TrimSuffix(strings.TrimSuffix(refspec.Dst, "*"), "/"))
+	}
+	return res
+}
+
+// FetchOptions controls how FetchWithOptions fetches.
+type FetchOptions struct {
+	// ShallowDepth limits the history fetched to this many commits
+	// from the tip of each remote branch.
+	ShallowDepth int
+	// ShallowSince limits the history fetched to commits after this time.
+	ShallowSince time.Time
+	// Deepen fetches this many more commits of history
+	// in a shallow repository.
+	Deepen int
+	// Prune removes remote-tracking refs that no longer exist on the remote.
+	Prune bool
+	// PruneTags removes local tags that no longer exist on the remote,
+	// along with what Prune removes.
+	PruneTags bool
+	// Progress, if not nil, is called as git reports its progress
+	// through each phase of the fetch, like CloneOptions.Progress.
+	// When fetching from several remotes, the calls for all of them
+	// are mixed together, but never made at the same time.
+	Progress func(phase string, current, total int)
+	// Auth, if not nil, is used instead of the Auth of the repository.
+	Auth *Auth
+	// Concurrency is how many remotes are fetched from at once.
+	// If it is 0, DefaultFetchConcurrency is used.
+	Concurrency int
+	// Timeout, if not 0, limits how long the fetch from
+	// each remote can take.
+	Timeout time.Duration
+}
+
+// DefaultFetchConcurrency is how many remotes are fetched
+// from at once, unless FetchOptions says otherwise.
+const DefaultFetchConcurrency = 4
+
+func (o FetchOptions) args() []string {
+	args := []string{}
+	if o.ShallowDepth > 0 {
+		args = append(args, "--depth", strconv.Itoa(o.ShallowDepth))
+	}
+	if !o.ShallowSince.IsZero() {
+		args = append(args, "--shallow-since="+shallowDate(o.ShallowSince))
+	}
+	if o.Deepen > 0 {
+		args = append(args, "--deepen", strconv.Itoa(o.Deepen))
+	}
+	if o.Prune || o.PruneTags {
+		args = append(args, "--prune")
+	}
+	if o.PruneTags {
+		args = append(args, "--prune-tags")
+	}
+	return args
 }
 
 // Fetch updates from a single remote.
-func (r *Repo) fetchOne(remote string, ok chan FetchStatus) {
-	cmd, _, _ := r.Git("fetch", "-q", "-t", remote)
-	err := cmd.Run()
-	ok <- FetchStatus{
-		Ok:     (err == nil),
-		Remote: remote,
+func (r *Repo) fetchOne(ctx context.Context, remote string, opts FetchOptions, ok chan FetchStatus) {
+	status := FetchStatus{Remote: remote}
+	start := time.Now()
+	defer func() {
+		status.Ok = (status.Err == nil)
+		status.Elapsed = time.Since(start)
+		ok <- status
+	}()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	if status.Err = ctx.Err(); status.Err != nil {
+		return
+	}
+	args := []string{"-t"}
+	if opts.Progress != nil {
+		args = append(args, "--progress")
+	}
+	// git 2.41 and later can report exactly what they updated.
+	porcelain := gitAtLeast(2, 41)
+	if porcelain {
+		args = append(args, "--porcelain")
+	}
+	auth := authOr(opts.Auth, r.Auth)
+	cmd, stdout, stderr := r.gitWithAuth(auth, "fetch", append(append(args, opts.args()...), remote)...)
+	if auth.Credentials != nil {
+		if status.Err = auth.provideCredentials(cmd, r.remoteURL(remote, false)); status.Err != nil {
+			return
+		}
+	}
+	if opts.Progress != nil {
+		withProgress(cmd, opts.Progress)
+	}
+	var before map[string]string
+	if !porcelain {
+		// Nothing says what pruned refs pointed at,
+		// so remember what the ones that could be pruned do now.
+		before = r.refSHAs(r.prunable(remote, opts)...)
+	}
+	status.Err = runContext(ctx, cmd)
+	r.ReloadRefs()
+	status.Stderr = stderr.String()
+	if porcelain {
+		status.Updates = parseFetchPorcelain(stdout.String())
+	} else {
+		status.Updates = parseFetch(status.Stderr)
+		r.fillFetchUpdates(status.Updates, before)
 	}
-	return
+}
+
+// fetchPool fetches from remotes, with no more than opts.Concurrency
+// fetches running at once, and sends the status of each to ok.
+// It returns once every fetch is done.
+func (r *Repo) fetchPool(ctx context.Context, remotes []string, opts FetchOptions, ok chan FetchStatus) {
+	workers := opts.Concurrency
+	if workers <= 0 {
+		workers = DefaultFetchConcurrency
+	}
+	if workers > len(remotes) {
+		workers = len(remotes)
+	}
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for remote := range jobs {
+				r.fetchOne(ctx, remote, opts, ok)
+			}
+		}()
+	}
+	for _, remote := range remotes {
+		jobs <- remote
+	}
+	close(jobs)
+	wg.Wait()
 }
 
 // Helper to enable empty slice -> all remotes the repo knows about.
@@ -141,13 +755,11 @@ func (r *Repo) allRemotes(remotes []string) []string {
 	return remotes
 }
 
-// AsyncFetch fetches updates from the passed remotes.
+// AsyncFetch fetches updates from the passed remotes, sending the
+// status of each fetch to ok as it finishes.
 // This expects to be called as a goroutine.
 func (r *Repo) AsyncFetch(remotes []string, ok chan FetchStatus) {
-	remotes = r.allRemotes(remotes)
-	for _, v := range remotes {
-		go r.fetchOne(v, ok)
-	}
+	r.fetchPool(context.Background(), r.allRemotes(remotes), FetchOptions{}, ok)
 }
 
 // FetchMap holds our map of remote names -> whether we fetched all updates from the remote.
@@ -155,19 +767,40 @@ type FetchMap map[string]bool
 
 // Fetch all updates from our remotes in parallel.
 func (r *Repo) Fetch(remotes []string) (res bool, items FetchMap) {
-	ok := make(chan FetchStatus)
+	return r.FetchWithOptions(remotes, FetchOptions{})
+}
+
+// FetchWithOptions fetches updates from our remotes in parallel, like Fetch.
+func (r *Repo) FetchWithOptions(remotes []string, opts FetchOptions) (res bool, items FetchMap) {
+	res, statuses := r.FetchContext(context.Background(), remotes, opts)
 	items = make(FetchMap)
-	res = true
-	remotes = r.allRemotes(remotes)
-	go r.AsyncFetch(remotes, ok)
-	for {
-		token := <-ok
-		items[token.Remote] = token.Ok
-		res = res && token.Ok
-		if len(items) == len(remotes) {
-			break
-		}
+	for _, status := range statuses {
+		items[status.Remote] = status.Ok
 	}
-	close(ok)
 	return res, items
 }
+
+// FetchContext fetches updates from our remotes in parallel, like
+// FetchWithOptions, and returns the status of the fetch from each
+// remote, in the same order as remotes.  If ctx is cancelled, any
+// fetches still running are killed, and those not started yet fail.
+func (r *Repo) FetchContext(ctx context.Context, remotes []string, opts FetchOptions) (res bool, statuses []FetchStatus) {
+	remotes = r.allRemotes(remotes)
+	opts.Progress = serialProgress(opts.Progress)
+	ok := make(chan FetchStatus, len(remotes))
+	r.fetchPool(ctx, remotes, opts, ok)
+	close(ok)
+	byRemote := make(map[string]FetchStatus)
+	for status := range ok {
+		byRemote[status.Remote] = status
+	}
+	res = true
+	statuses = make([]FetchStatus, 0, len(remotes))
+	for _, remote := range remotes {
+		status := byRemote[remote]
+		statuses = append(statuses, status)
+		res = res && status.Ok
+	}
+	r.ReloadRefs()
+	return res, statuses
+}
@@ -8,11 +8,15 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // ConfigMap maps config keys to their values.
@@ -22,6 +26,11 @@ type ConfigMap map[string]string
 type RefMap map[string]*Ref
 
 // Repo is the main struct that we use to track Git repositories.
+// The methods on a Repo can be called from several goroutines at once.
+// The Refs it hands out are copies that belong to the caller, so a Ref
+// is safe to use from several goroutines only as long as none of them
+// moves it (with Reload, Merge, and the like).
+// Do not change the exported fields of a Repo while it is in use.
 type Repo struct {
 	// GitDir is the directory that the Git metadata is in for this repo.
 	GitDir string
@@ -31,13 +40,68 @@ type Repo struct {
 	refs RefMap
 	// cfg holds the cached config data.
 	cfg ConfigMap
+	// ignores is the check-ignore process CheckIgnore keeps running.
+	ignores *ignoreChecker
+	// objects is the ObjectReader ObjectReader hands out.
+	objects *ObjectReader
+	// graphOnce makes sure AutoCommitGraph only checks for a
+	// commit-graph once.  It is separate from mu, so writing the
+	// commit-graph does not hold everything else up.
+	graphOnce sync.Once
+	// refsGen and cfgGen count how many times the refs and config
+	// have been reloaded, so loadRefs and readConfig can tell if
+	// what they loaded is already out of date.
+	refsGen, cfgGen int
+	// mu guards refs, cfg, refsGen, cfgGen, ignores, and objects.
+	// It is never held while waiting on a git command.
+	// refs and cfg are replaced, never changed in place, so what
+	// loadRefs and readConfig return can be used without holding mu.
+	mu sync.Mutex
+	// NoAdvice keeps git from printing hints and advice
+	// for every command.  Hints that git prints anyway
+	// end up in GitError.Hints.
+	NoAdvice bool
+	// overrides holds key=value config settings that are
+	// passed with -c to every command.
+	overrides []string
+	// Profile controls the environment git commands run in.
+	Profile Profile
+	// Auth controls how git authenticates to remotes.
+	Auth Auth
+	// AutoCommitGraph makes Contains and AheadBehind write a
+	// commit-graph the first time they are used, if the repository
+	// does not have one.  This makes them much faster on long histories.
+	AutoCommitGraph bool
+}
+
+// Profile controls the environment that git commands run in.
+// The zero value is what the parsers in this package expect,
+// and the fields opt out of that.
+type Profile struct {
+	// Localized lets git print messages in the user's language.
+	// Otherwise git runs with LC_ALL=C, so that its output can be parsed.
+	Localized bool
+	// OptionalLocks lets git take locks that it does not need,
+	// like the one git status takes to refresh the index.
+	OptionalLocks bool
+}
+
+func (p Profile) env() []string {
+	env := os.Environ()
+	if !p.Localized {
+		env = append(env, "LC_ALL=C", "LANG=C")
+	}
+	if !p.OptionalLocks {
+		env = append(env, "GIT_OPTIONAL_LOCKS=0")
+	}
+	return env
 }
 
 var gitCmd string
-var statusRE *regexp.Regexp
 var statMap = map[string]string{
 	" ": "unmodified",
 	"M": "modified",
+	"T": "type changed",
 	"A": "added",
 	"D": "deleted",
 	"R": "renamed",
@@ -47,33 +111,149 @@ var statMap = map[string]string{
 	"!": "ignored",
 }
 
+// noAdvice caches the -c settings that NoAdvice needs.
+var noAdvice struct {
+	once sync.Once
+	args []string
+}
+
+// gitVersion caches the major and minor version of the git we run.
+var gitVersion struct {
+	once         sync.Once
+	major, minor int
+}
+
+// gitAtLeast tests to see if the git we run is at least major.minor.
+func gitAtLeast(major, minor int) bool {
+	gitVersion.once.Do(func() {
+		cmd, out, _ := Git("version")
+		if cmd.Run() != nil {
+			return
+		}
+		// git version 2.39.5
+		fields := strings.Fields(out.String())
+		if len(fields) < 3 {
+			return
+		}
+		parts := strings.SplitN(fields[2], ".", 3)
+		if len(parts) < 2 {
+			return
+		}
+		gitVersion.major, _ = strconv.Atoi(parts[0])
+		gitVersion.minor, _ = strconv.Atoi(parts[1])
+	})
+	return gitVersion.major > major || (gitVersion.major == major && gitVersion.minor >= minor)
+}
+
+// noAdviceArgs returns the -c settings that turn off git's advice.
+// Git 2.46 and later turn all of it off when GIT_ADVICE is 0, so
+// they need none.  Older versions are asked which advice.* settings
+// they know about, so the list never goes stale.
+func noAdviceArgs() []string {
+	noAdvice.once.Do(func() {
+		if gitAtLeast(2, 46) {
+			return
+		}
+		cmd, out, _ := Git("help", "--config")
+		if cmd.Run() != nil {
+			return
+		}
+		for _, key := range strings.Split(out.String(), "\n") {
+			if strings.HasPrefix(key, "advice.") && !strings.ContainsAny(key, "*<") {
+				noAdvice.args = append(noAdvice.args, "-c", key+"=false")
+			}
+		}
+	})
+	return noAdvice.args
+}
+
 func init() {
 	var err error
 	if gitCmd, err = exec.LookPath("git"); err != nil {
 		panic("Cannot find git command!")
 	}
-	statusRE = regexp.MustCompile("^([ MADRCU!?])([ MADRCU?!]) (.*)$")
 }
 
-func findRepo(path string) (found bool, gitdir, workdir string) {
+// readGitFile follows the gitdir: pointer in a .git file, as used
+// by linked worktrees and submodules.
+func readGitFile(path string) (gitdir string, err error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	line := strings.TrimSpace(string(buf))
+	if !strings.HasPrefix(line, "gitdir:") {
+		return "", fmt.Errorf("%s does not point at a git directory", path)
+	}
+	gitdir = strings.TrimSpace(strings.TrimPrefix(line, "gitdir:"))
+	if !filepath.IsAbs(gitdir) {
+		gitdir = filepath.Join(filepath.Dir(path), gitdir)
+	}
+	return filepath.Clean(gitdir), nil
+}
+
+// isGitDir tests to see if path looks like a git directory,
+// whatever it happens to be named.
+func isGitDir(path string) bool {
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(path, name)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// gitDirWorkDir works out where the working tree that goes with gitdir is.
+// Bare repositories do not have one, and the git directory of an ordinary
+// repository lives at the top of its working tree unless core.worktree
+// says otherwise.
+func gitDirWorkDir(gitdir string) (workdir string) {
+	cmd, out, _ := Git("--git-dir="+gitdir, "rev-parse", "--is-bare-repository")
+	if run(cmd) != nil || strings.TrimSpace(out.String()) != "false" {
+		return ""
+	}
+	cmd, out, _ = Git("--git-dir="+gitdir, "config", "core.worktree")
+	if run(cmd) == nil {
+		workdir = strings.TrimSpace(out.String())
+		if !filepath.IsAbs(workdir) {
+			workdir = filepath.Join(gitdir, workdir)
+		}
+		return filepath.Clean(workdir)
+	}
+	if filepath.Base(gitdir) == ".git" {
+		return filepath.Dir(gitdir)
+	}
+	// There is no telling where the working tree is,
+	// so treat it like a bare repository.
+	return ""
+}
+
+func findRepo(path string) (found bool, gitdir, workdir string, err error) {
 	stat, err := os.Stat(path)
 	if err != nil {
-		panic("Could not stat " + path)
+		return false, "", "", fmt.Errorf("Could not stat %s: %v", path, err)
 	}
 	if !stat.IsDir() {
-		panic(path + " is not a directory!")
+		return false, "", "", fmt.Errorf("%s is not a directory!", path)
 	}
-	if strings.HasSuffix(path, ".git") {
-		if stat, err = os.Stat(filepath.Join(path, "config")); err == nil {
-			found = true
-			gitdir = path
-			workdir = ""
-			return
+	if isGitDir(path) {
+		return true, path, gitDirWorkDir(path), nil
+	}
+	dotGit := filepath.Join(path, ".git")
+	if stat, err = os.Stat(dotGit); err == nil && stat.Mode().IsRegular() {
+		// .git is a pointer to the real git directory.
+		if gitdir, err = readGitFile(dotGit); err != nil {
+			return false, "", "", nil
 		}
+		// Linked worktrees do not have their own config, but
+		// every git directory has a HEAD.
+		if _, err = os.Stat(filepath.Join(gitdir, "HEAD")); err != nil {
+			return false, "", "", nil
+		}
+		return true, gitdir, path, nil
 	}
-	if stat, err = os.Stat(filepath.Join(path, ".git", "config")); err != nil {
-		found = false
-		return
+	if _, err = os.Stat(filepath.Join(dotGit, "config")); err != nil {
+		return false, "", "", nil
 	}
 	found = true
 	gitdir = filepath.Join(path, ".git")
@@ -92,12 +272,15 @@ func Open(path string) (repo *Repo, err error) {
 		return
 	}
 	for {
-		found, gitdir, workdir := findRepo(path)
+		found, gitdir, workdir, err := findRepo(path)
+		if err != nil {
+			return nil, err
+		}
 		if found {
 			repo = new(Repo)
 			repo.GitDir = gitdir
 			repo.WorkDir = workdir
-			return
+			return repo, nil
 		}
 		parent := filepath.Dir(path)
 		if parent == path {
@@ -115,20 +298,56 @@ func Git(cmd string, args ...string) (res *exec.Cmd, stdout, stderr *bytes.Buffe
 	cmdArgs[0] = cmd
 	cmdArgs = append(cmdArgs, args...)
 	res = exec.Command(gitCmd, cmdArgs...)
+	res.Env = Profile{}.env()
 	stdout, stderr = new(bytes.Buffer), new(bytes.Buffer)
 	res.Stdout, res.Stderr = stdout, stderr
 	return
 }
 
+// GitWithInput is Git, with in hooked up to the standard input of the command.
+func GitWithInput(in io.Reader, cmd string, args ...string) (res *exec.Cmd, stdout, stderr *bytes.Buffer) {
+	res, stdout, stderr = Git(cmd, args...)
+	res.Stdin = in
+	return
+}
+
 // Git is a helper for making sure that the Git command runs in the proper repository.
 func (r *Repo) Git(cmd string, args ...string) (res *exec.Cmd, out, err *bytes.Buffer) {
+	return r.gitWithAuth(r.Auth, cmd, args...)
+}
+
+// GitWithInput is Repo.Git, with in hooked up to the standard input of the command.
+func (r *Repo) GitWithInput(in io.Reader, cmd string, args ...string) (res *exec.Cmd, out, err *bytes.Buffer) {
+	res, out, err = r.Git(cmd, args...)
+	res.Stdin = in
+	return
+}
+
+// gitWithAuth is Git, but authenticating with auth instead of r.Auth.
+func (r *Repo) gitWithAuth(auth Auth, cmd string, args ...string) (res *exec.Cmd, out, err *bytes.Buffer) {
 	var path string
 	if r.WorkDir == "" {
 		path = r.GitDir
 	} else {
 		path = r.WorkDir
 	}
+	if r.NoAdvice || len(r.overrides) > 0 {
+		cmdArgs := make([]string, 0, 2*len(r.overrides)+len(args)+1)
+		if r.NoAdvice {
+			cmdArgs = append(cmdArgs, noAdviceArgs()...)
+		}
+		for _, setting := range r.overrides {
+			cmdArgs = append(cmdArgs, "-c", setting)
+		}
+		cmdArgs = append(append(cmdArgs, cmd), args...)
+		cmd, args = cmdArgs[0], cmdArgs[1:]
+	}
 	res, out, err = Git(cmd, args...)
+	res.Env = r.Profile.env()
+	if r.NoAdvice {
+		res.Env = append(res.Env, "GIT_ADVICE=0")
+	}
+	auth.apply(res)
 	res.Dir = path
 	return
 }
@@ -136,28 +355,218 @@ func (r *Repo) Git(cmd string, args ...string) (res *exec.Cmd, out, err *bytes.B
 // Init initializes new Get metadata at the passed path.
 // The rest of the args are passed to the 'git init' command unchanged.
 func Init(path string, args ...string) (res *Repo, err error) {
-	cmd, _, stderr := Git("init", append(args, path)...)
-	if err = cmd.Run(); err != nil {
-		return nil, errors.New(stderr.String())
+	cmd, _, _ := Git("init", append(args, path)...)
+	if err = run(cmd); err != nil {
+		return nil, err
 	}
 	res, err = Open(path)
 	return
 }
 
+// InitOptions controls how InitWithOptions creates a repository.
+type InitOptions struct {
+	// Bare creates a bare repository, with no working tree.
+	Bare bool
+	// InitialBranch is the branch HEAD points at.
+	// If empty, git uses init.defaultBranch.
+	InitialBranch string
+	// TemplateDir is the directory to copy hooks and such from.
+	TemplateDir string
+	// Shared is passed to git init --shared, e.g. "group".
+	Shared string
+}
+
+func (o InitOptions) args() []string {
+	args := []string{"-q"}
+	if o.Bare {
+		args = append(args, "--bare")
+	}
+	if o.InitialBranch != "" {
+		args = append(args, "--initial-branch="+o.InitialBranch)
+	}
+	if o.TemplateDir != "" {
+		args = append(args, "--template="+o.TemplateDir)
+	}
+	if o.Shared != "" {
+		args = append(args, "--shared="+o.Shared)
+	}
+	return args
+}
+
+// InitWithOptions initializes a new repository at path, like Init.
+func InitWithOptions(path string, opts InitOptions) (res *Repo, err error) {
+	return Init(path, opts.args()...)
+}
+
+// BareFarmOptions controls how InitBareFarm creates repositories.
+type BareFarmOptions struct {
+	// TemplateDir is the template directory shared by all the repositories.
+	TemplateDir string
+	// DefaultBranch is the initial branch HEAD points at.
+	DefaultBranch string
+	// Shared is passed to git init --shared, e.g. "group".
+	Shared string
+	// PostReceiveHook, if not empty, is installed as the
+	// post-receive hook in every repository.
+	PostReceiveHook string
+}
+
+// InitBareFarm creates a bare repository under root for each of names.
+// Repositories are named <name>.git, and any that already exist are
+// reinitialized in place, which git guarantees to be safe.
+func InitBareFarm(root string, names []string, opts BareFarmOptions) (res []*Repo, err error) {
+	if err = os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	args := []string{"--bare", "-q"}
+	if opts.TemplateDir != "" {
+		args = append(args, "--template="+opts.TemplateDir)
+	}
+	if opts.DefaultBranch != "" {
+		args = append(args, "--initial-branch="+opts.DefaultBranch)
+	}
+	if opts.Shared != "" {
+		args = append(args, "--shared="+opts.Shared)
+	}
+	res = make([]*Repo, 0, len(names))
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".git") {
+			name = name + ".git"
+		}
+		repo, err := Init(filepath.Join(root, name), args...)
+		if err != nil {
+			return res, err
+		}
+		if opts.PostReceiveHook != "" {
+			hook := filepath.Join(repo.GitDir, "hooks", "post-receive")
+			if err = os.MkdirAll(filepath.Dir(hook), 0755); err != nil {
+				return res, err
+			}
+			if err = ioutil.WriteFile(hook, []byte(opts.PostReceiveHook), 0755); err != nil {
+				return res, err
+			}
+		}
+		res = append(res, repo)
+	}
+	return res, nil
+}
+
 // Clone a new git repository.  The clone will be created in the current
 // directory.
 func Clone(source, target string, args ...string) (res *Repo, err error) {
-	cmd, _, stderr := Git("clone", append(args, source, target)...)
-	if err = cmd.Run(); err != nil {
-		return nil, errors.New(stderr.String())
+	return clone(source, target, args, nil, Auth{})
+}
+
+func clone(source, target string, args []string, progress func(phase string, current, total int), auth Auth) (res *Repo, err error) {
+	if progress != nil {
+		args = append(args, "--progress")
+	}
+	cmd, _, _ := Git("clone", append(args, source, target)...)
+	auth.apply(cmd)
+	if err = auth.provideCredentials(cmd, source); err != nil {
+		return nil, err
+	}
+	if progress != nil {
+		withProgress(cmd, progress)
+	}
+	if err = run(cmd); err != nil {
+		return nil, err
 	}
 	res, err = Open(target)
 	return
 }
 
+// CloneOptions controls how CloneWithOptions clones a repository.
+type CloneOptions struct {
+	// Bare makes a bare clone, with no working tree.
+	Bare bool
+	// Branch checks out this branch instead of the remote's HEAD.
+	Branch string
+	// SingleBranch only clones the history of one branch.
+	SingleBranch bool
+	// ShallowDepth makes a shallow clone with this many commits of history.
+	ShallowDepth int
+	// ShallowSince makes a shallow clone with history back to this time.
+	ShallowSince time.Time
+	// NoTags does not clone any tags.
+	NoTags bool
+	// Progress, if not nil, is called as git reports its progress
+	// through each phase of the clone, like "Receiving objects".
+	// total is 0 for phases where git does not know how much work
+	// there is to do.
+	Progress func(phase string, current, total int)
+	// Auth controls how git authenticates to source.
+	// If it is nil, git will not prompt for credentials.
+	Auth *Auth
+}
+
+// shallowDate formats a time so that --shallow-since can parse it.
+func shallowDate(t time.Time) string {
+	return t.Format("2006-01-02 15:04:05 -0700")
+}
+
+func (o CloneOptions) args() []string {
+	args := []string{}
+	if o.Bare {
+		args = append(args, "--bare")
+	}
+	if o.Branch != "" {
+		args = append(args, "--branch", o.Branch)
+	}
+	if o.SingleBranch {
+		args = append(args, "--single-branch")
+	}
+	if o.ShallowDepth > 0 {
+		args = append(args, "--depth", strconv.Itoa(o.ShallowDepth))
+	}
+	if !o.ShallowSince.IsZero() {
+		args = append(args, "--shallow-since="+shallowDate(o.ShallowSince))
+	}
+	if o.NoTags {
+		args = append(args, "--no-tags")
+	}
+	return args
+}
+
+// CloneWithOptions clones a new git repository, like Clone does.
+func CloneWithOptions(source, target string, opts CloneOptions) (res *Repo, err error) {
+	return clone(source, target, opts.args(), opts.Progress, authOr(opts.Auth, Auth{}))
+}
+
+// IsShallow tests to see if this is a shallow repository,
+// which is missing some of its history.
+func (r *Repo) IsShallow() (res bool, err error) {
+	cmd, out, _ := r.Git("rev-parse", "--is-shallow-repository")
+	if err = run(cmd); err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(out.String()) == "true", nil
+}
+
+// Unshallow fetches the rest of the history of a shallow repository
+// from its default remote.
+func (r *Repo) Unshallow() (err error) {
+	cmd, _, _ := r.Git("fetch", "-q", "--unshallow")
+	if err = run(cmd); err != nil {
+		return err
+	}
+	r.ReloadRefs()
+	return nil
+}
+
 // StatLine holds interesting bits of git status output.
 type StatLine struct {
-	indexStat, workStat, oldPath, newPath string
+	// IndexStat and WorkStat are the single-character status codes
+	// for the index and the working tree.  They are keys into statMap.
+	IndexStat, WorkStat string
+	// OldPath is the path before a rename or copy.  It is the
+	// same as NewPath for everything else.
+	OldPath, NewPath string
+	// Score is the similarity percentage of a rename or copy,
+	// and 0 for everything else.
+	Score int
+	// Submodule is the state of a submodule, and nil for everything else.
+	Submodule *SubmoduleState
 }
 
 // StatLines is a slice of statuses.
@@ -166,56 +575,62 @@ type StatLines []*StatLine
 // Print prints a StatLine in human readable format.
 func (s *StatLine) Print() string {
 	var res string
-	if s.indexStat == "R" {
-		res = fmt.Sprintf("%s was renamed to %s\n", s.oldPath, s.newPath)
+	switch s.IndexStat {
+	case "R":
+		res = fmt.Sprintf("%s was renamed to %s (%d%% similar)\n", s.OldPath, s.NewPath, s.Score)
+	case "C":
+		res = fmt.Sprintf("%s was copied to %s (%d%% similar)\n", s.OldPath, s.NewPath, s.Score)
 	}
 	res = res + fmt.Sprintf("%s is %s in the index and %s in the working tree.",
-		s.newPath,
-		statMap[s.indexStat],
-		statMap[s.workStat])
+		s.NewPath,
+		statMap[s.IndexStat],
+		statMap[s.WorkStat])
 	return res
 }
 
-func (r *Repo) mapStatus() (res StatLines) {
-	var thisStat *StatLine
-	cmd, out, err := r.Git("status", "--porcelain", "-z")
-	if cmd.Run() != nil {
-		panic(err.String())
+func (r *Repo) mapStatus(opts StatusOptions) (res StatLines, err error) {
+	cmd, out, _ := r.Git("status", opts.args()...)
+	if err = run(cmd); err != nil {
+		return nil, err
 	}
-	for {
-		line, err := out.ReadString(0)
-		if err != nil {
-			break
-		}
-		parts := statusRE.FindStringSubmatch(line)
-		if parts != nil {
-			if thisStat != nil {
-				res = append(res, thisStat)
-			}
-			thisStat = new(StatLine)
-			thisStat.indexStat = parts[1]
-			thisStat.workStat = parts[2]
-			thisStat.oldPath = parts[3]
-			thisStat.newPath = parts[3]
-		} else if thisStat != nil {
-			thisStat.newPath = line
-		} else {
-			panic("Cannot happen!")
-		}
+	_, entries := parseStatus(out.String())
+	for _, entry := range entries {
+		res = append(res, entry.statLine())
 	}
-	if thisStat != nil {
-		res = append(res, thisStat)
-	}
-	return
+	return res, nil
 }
 
 // IsClean checks to see if there are any uncomitted or untracked changes.
+// If git status fails, the working tree is not considered clean.
 func (r *Repo) IsClean() (res bool, lines StatLines) {
-	lines = r.mapStatus()
-	res = len(lines) == 0
+	return r.IsCleanWithOptions(StatusOptions{})
+}
+
+// IsCleanWithOptions checks to see if there are any uncommitted or
+// untracked changes, like IsClean.  opts can make it skip untracked
+// files or submodules, and Ignored is not used.
+func (r *Repo) IsCleanWithOptions(opts StatusOptions) (res bool, lines StatLines) {
+	res, lines, _ = r.CheckClean(opts)
 	return
 }
 
+// CheckClean is IsCleanWithOptions, but it returns the error
+// git status failed with, if it did.
+func (r *Repo) CheckClean(opts StatusOptions) (res bool, lines StatLines, err error) {
+	opts.Ignored = false
+	if lines, err = r.mapStatus(opts); err != nil {
+		return false, nil, err
+	}
+	return len(lines) == 0, lines, nil
+}
+
+// IsCleanPath checks to see if there are any uncommitted or untracked
+// changes under paths.  Only paths are looked at, so this is much
+// quicker than IsClean in a big working tree.
+func (r *Repo) IsCleanPath(paths ...string) (res bool, lines StatLines) {
+	return r.IsCleanWithOptions(StatusOptions{Paths: paths})
+}
+
 // IsRaw checks to see if this is a raw repository.
 func (r *Repo) IsRaw() (res bool) {
 	return r.WorkDir == ""
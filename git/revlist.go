@@ -0,0 +1,90 @@
+package git
+
+import (
+	"strconv"
+	"strings"
+)
+
+// RevListOptions controls which commits RevList lists.
+type RevListOptions struct {
+	// Revs are the revisions and ranges to list the commits of,
+	// like "master", "^origin/master", "a..b", or "a...b".
+	Revs []string
+	// MaxCount stops after this many commits, if it is more than 0.
+	MaxCount int
+	// Merges lists only merge commits, and NoMerges leaves them out.
+	Merges, NoMerges bool
+	// Count counts the commits instead of listing them.
+	Count bool
+	// LeftRight splits up the commits of a symmetric difference (a...b)
+	// by which side they are reachable from.
+	LeftRight bool
+	// Paths limits the commits to those that change these pathspecs.
+	Paths []string
+}
+
+func (o RevListOptions) args() []string {
+	args := []string{}
+	if o.MaxCount > 0 {
+		args = append(args, "--max-count="+strconv.Itoa(o.MaxCount))
+	}
+	if o.Merges {
+		args = append(args, "--merges")
+	}
+	if o.NoMerges {
+		args = append(args, "--no-merges")
+	}
+	if o.Count {
+		args = append(args, "--count")
+	}
+	if o.LeftRight {
+		args = append(args, "--left-right")
+	}
+	args = append(args, o.Revs...)
+	return append(append(args, "--"), o.Paths...)
+}
+
+// RevListResult holds what RevList found.
+type RevListResult struct {
+	// SHAs lists the commits, newest first.  It is empty if
+	// Count was set.
+	SHAs []string
+	// Left and Right split SHAs up by side when LeftRight was set.
+	Left, Right []string
+	// Count is the number of commits, and LeftCount and RightCount
+	// split it up by side when LeftRight was set.
+	Count, LeftCount, RightCount int
+}
+
+// RevList lists (or counts) commits, like git rev-list.
+func (r *Repo) RevList(opts RevListOptions) (res *RevListResult, err error) {
+	cmd, out, _ := r.Git("rev-list", opts.args()...)
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	res = &RevListResult{}
+	if opts.Count {
+		fields := strings.Fields(out.String())
+		if opts.LeftRight && len(fields) == 2 {
+			res.LeftCount = atoiDefault(fields[0], 0)
+			res.RightCount = atoiDefault(fields[1], 0)
+			res.Count = res.LeftCount + res.RightCount
+		} else if len(fields) == 1 {
+			res.Count = atoiDefault(fields[0], 0)
+		}
+		return res, nil
+	}
+	res.SHAs = strings.Fields(out.String())
+	for i, sha := range res.SHAs {
+		switch sha[0] {
+		case '<':
+			res.SHAs[i] = sha[1:]
+			res.Left = append(res.Left, sha[1:])
+		case '>':
+			res.SHAs[i] = sha[1:]
+			res.Right = append(res.Right, sha[1:])
+		}
+	}
+	res.Count, res.LeftCount, res.RightCount = len(res.SHAs), len(res.Left), len(res.Right)
+	return res, nil
+}
@@ -0,0 +1,113 @@
+package git
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Finding is something a ScanRange matcher found in the lines
+// added by a commit.
+type Finding struct {
+	SHA, Path string
+	// Line is the line number in the file as of the commit.
+	// Matchers should set it to the index into the added lines
+	// they were passed, and ScanRange will translate it.
+	Line int
+	// Text and Description are for the matcher to fill in
+	// as it sees fit.
+	Text, Description string
+}
+
+// ScanRange walks through every commit in rangeSpec (as understood by
+// git log) and calls matcher once for each file a commit changed, with
+// the lines the commit added to the file.  The Findings that matcher
+// returns are collected and returned, with their SHA and Path filled in.
+// The whole range is scanned in a single pass over git log -p output.
+func (r *Repo) ScanRange(rangeSpec string, matcher func(path string, added []string) []Finding) (res []Finding, err error) {
+	cmd, _, _ := r.Git("log", "-p", "-U0",
+		"--no-color",
+		"--no-ext-diff",
+		"--no-renames",
+		"--src-prefix=a/",
+		"--dst-prefix=b/",
+		"--format=%x1e%H",
+		rangeSpec, "--")
+	cmd.Stdout = nil
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	if res, err = scanPatches(out, matcher); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, err
+	}
+	if err = wait(cmd); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// scanPatches does the work of ScanRange, on what git log printed.
+func scanPatches(out io.Reader, matcher func(path string, added []string) []Finding) (res []Finding, err error) {
+	res = make([]Finding, 0)
+	var sha, path string
+	var added []string
+	var lineNums []int
+	var newLine int
+	// A line starting with +++ is only a header if it follows
+	// the --- line of a file, and not inside a hunk, where it is
+	// an added line that starts with ++.
+	var inHunk, sawOld bool
+	flush := func() {
+		if path != "" && len(added) > 0 {
+			for _, f := range matcher(path, added) {
+				if f.Line >= 0 && f.Line < len(lineNums) {
+					f.Line = lineNums[f.Line]
+				}
+				if f.SHA == "" {
+					f.SHA = sha
+				}
+				if f.Path == "" {
+					f.Path = path
+				}
+				res = append(res, f)
+			}
+		}
+		path, added, lineNums = "", nil, nil
+	}
+	scanner := bufio.NewScanner(out)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "\x1e"):
+			flush()
+			sha = line[1:]
+			inHunk, sawOld = false, false
+		case strings.HasPrefix(line, "diff --git "):
+			flush()
+			inHunk, sawOld = false, false
+		case !inHunk && strings.HasPrefix(line, "--- "):
+			sawOld = true
+		case !inHunk && sawOld && strings.HasPrefix(line, "+++ "):
+			path = diffPath(line[4:], "b/")
+			sawOld = false
+		case strings.HasPrefix(line, "@@ "):
+			inHunk = true
+			if parts := hunkRE.FindStringSubmatch(line); parts != nil {
+				newLine = atoiDefault(parts[3], 0)
+			}
+		case inHunk && strings.HasPrefix(line, "+"):
+			added = append(added, line[1:])
+			lineNums = append(lineNums, newLine)
+			newLine++
+		}
+	}
+	flush()
+	return res, scanner.Err()
+}
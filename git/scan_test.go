@@ -0,0 +1,89 @@
+package git
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScanPatches(t *testing.T) {
+	// collect reports every added line, so the tests can see
+	// which path each one was put under.
+	collect := func(path string, added []string) (res []Finding) {
+		for i, line := range added {
+			res = append(res, Finding{Line: i, Text: line})
+		}
+		return res
+	}
+	for _, tc := range []struct {
+		name, out string
+		want      []Finding
+	}{
+		{
+			name: "simple",
+			out: "\x1eabc\n" +
+				"diff --git a/f b/f\n--- a/f\n+++ b/f\n@@ -1,0 +2,2 @@\n+one\n+two\n",
+			want: []Finding{
+				{SHA: "abc", Path: "f", Line: 2, Text: "one"},
+				{SHA: "abc", Path: "f", Line: 3, Text: "two"},
+			},
+		},
+		{
+			name: "added line that looks like a header",
+			out: "\x1eabc\n" +
+				"diff --git a/f b/f\n--- a/f\n+++ b/f\n@@ -0,0 +1,2 @@\n+++ not a header\n+after\n" +
+				"diff --git a/g b/g\n--- a/g\n+++ b/g\n@@ -0,0 +1 @@\n+in g\n",
+			want: []Finding{
+				{SHA: "abc", Path: "f", Line: 1, Text: "++ not a header"},
+				{SHA: "abc", Path: "f", Line: 2, Text: "after"},
+				{SHA: "abc", Path: "g", Line: 1, Text: "in g"},
+			},
+		},
+		{
+			name: "removed line that looks like a header",
+			out: "\x1eabc\n" +
+				"diff --git a/f b/f\n--- a/f\n+++ b/f\n@@ -1 +1 @@\n--- old\n+new\n",
+			want: []Finding{
+				{SHA: "abc", Path: "f", Line: 1, Text: "new"},
+			},
+		},
+		{
+			name: "several commits",
+			out: "\x1eabc\n" +
+				"diff --git a/f b/f\n--- a/f\n+++ b/f\n@@ -0,0 +1 @@\n+first\n" +
+				"\x1edef\n" +
+				"diff --git a/f b/f\n--- /dev/null\n+++ b/h\n@@ -0,0 +1 @@\n+second\n",
+			want: []Finding{
+				{SHA: "abc", Path: "f", Line: 1, Text: "first"},
+				{SHA: "def", Path: "h", Line: 1, Text: "second"},
+			},
+		},
+	} {
+		got, err := scanPatches(strings.NewReader(tc.out), collect)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s:\ngot  %+v\nwant %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestScanRangePlusLines(t *testing.T) {
+	r := newRepo(t)
+	write(t, r, "a", "++ tricky\nsecret\n")
+	write(t, r, "b", "secret\n")
+	sh(t, r, "add", ".")
+	sh(t, r, "commit", "-qm", "a")
+	res, err := r.ScanRange("HEAD", func(path string, added []string) (res []Finding) {
+		for i, line := range added {
+			if line == "secret" {
+				res = append(res, Finding{Line: i})
+			}
+		}
+		return res
+	})
+	if err != nil || len(res) != 2 || res[0].Path != "a" || res[0].Line != 2 || res[1].Path != "b" || res[1].Line != 1 {
+		t.Fatalf("%+v %v", res, err)
+	}
+}
@@ -0,0 +1,299 @@
+package git
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FileState is what has happened to a path in the index
+// or in the working tree, as a git status code.
+type FileState byte
+
+// These are the states git status reports.
+const (
+	StateUnmodified  FileState = ' '
+	StateModified    FileState = 'M'
+	StateTypeChanged FileState = 'T'
+	StateAdded       FileState = 'A'
+	StateDeleted     FileState = 'D'
+	StateRenamed     FileState = 'R'
+	StateCopied      FileState = 'C'
+	StateUnmerged    FileState = 'U'
+	StateUntracked   FileState = '?'
+	StateIgnored     FileState = '!'
+)
+
+// String returns the name of the state, like "modified".
+func (s FileState) String() string {
+	if name, found := statMap[string(s)]; found {
+		return name
+	}
+	return fmt.Sprintf("unknown state %q", byte(s))
+}
+
+// MarshalText makes FileStates show up by name in JSON.
+func (s FileState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// fileState translates a porcelain v2 status code into a FileState.
+func fileState(code byte) FileState {
+	if code == '.' {
+		return StateUnmodified
+	}
+	return FileState(code)
+}
+
+// StatusEntry is the status of a single path.
+type StatusEntry struct {
+	// IndexState and WorktreeState are what has happened to
+	// the path in the index and in the working tree.
+	IndexState, WorktreeState FileState
+	Path                      string
+	// OrigPath is where a renamed or copied path came from,
+	// and empty for everything else.
+	OrigPath string
+	// Score is the similarity percentage of a rename or copy.
+	Score int
+	// Submodule is the state of a submodule, and nil for everything else.
+	Submodule *SubmoduleState
+}
+
+// MarshalJSON leaves out the fields that do not apply to the entry.
+func (e StatusEntry) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		IndexState    FileState       `json:"indexState"`
+		WorktreeState FileState       `json:"worktreeState"`
+		Path          string          `json:"path"`
+		OrigPath      string          `json:"origPath,omitempty"`
+		Score         int             `json:"score,omitempty"`
+		Submodule     *SubmoduleState `json:"submodule,omitempty"`
+	}{e.IndexState, e.WorktreeState, e.Path, e.OrigPath, e.Score, e.Submodule})
+}
+
+// Print prints a StatusEntry in human readable format.
+func (e *StatusEntry) Print() string {
+	return e.statLine().Print()
+}
+
+// statLine translates e into the older StatLine.
+func (e *StatusEntry) statLine() *StatLine {
+	res := &StatLine{
+		IndexStat: string(e.IndexState),
+		WorkStat:  string(e.WorktreeState),
+		OldPath:   e.Path,
+		NewPath:   e.Path,
+		Score:     e.Score,
+		Submodule: e.Submodule,
+	}
+	if e.OrigPath != "" {
+		res.OldPath = e.OrigPath
+	}
+	return res
+}
+
+// SubmoduleState is what git status says about a submodule.
+type SubmoduleState struct {
+	// CommitChanged is true if the submodule has a different commit
+	// checked out than the one recorded in the index.
+	CommitChanged bool `json:"commitChanged"`
+	// Modified and Untracked are true if the working tree of the
+	// submodule has changes to tracked files, or untracked files.
+	Modified  bool `json:"modified"`
+	Untracked bool `json:"untracked"`
+}
+
+// parseSubmoduleState parses the <sub> field of a porcelain v2 record.
+// It returns nil for things that are not submodules.
+func parseSubmoduleState(sub string) *SubmoduleState {
+	if len(sub) != 4 || sub[0] != 'S' {
+		return nil
+	}
+	return &SubmoduleState{
+		CommitChanged: sub[1] == 'C',
+		Modified:      sub[2] == 'M',
+		Untracked:     sub[3] == 'U',
+	}
+}
+
+// Status is the state of the index and working tree,
+// as git status --porcelain=v2 --branch sees it.
+type Status struct {
+	// Branch is the short name of the checked out branch.
+	// If HEAD is detached, Branch is empty and Detached is true.
+	Branch   string
+	Detached bool
+	// SHA is the commit HEAD points at, and is empty in
+	// a repository that has no commits yet.
+	SHA string
+	// Upstream is the short name of the branch that Branch tracks, if any.
+	// Ahead and Behind count the commits that are only on Branch
+	// and only on Upstream.
+	Upstream      string
+	Ahead, Behind int
+	// Staged holds the paths with changes in the index, and Unstaged
+	// the paths with changes in the working tree.  A path can be in both.
+	Staged, Unstaged []*StatusEntry
+	// Unmerged holds the paths with merge conflicts.
+	Unmerged []*StatusEntry
+	// Untracked and Ignored hold the untracked and ignored paths.
+	Untracked, Ignored []*StatusEntry
+}
+
+// parseStatus parses the output of git status --porcelain=v2 -z, with
+// or without --branch.  Along with the Status, it returns every entry
+// except the ignored ones, in the order git listed them.
+func parseStatus(out string) (res *Status, all []*StatusEntry) {
+	res = &Status{}
+	records := strings.Split(out, "\x00")
+	for i := 0; i < len(records); i++ {
+		line := records[i]
+		if len(line) < 2 {
+			continue
+		}
+		entry := new(StatusEntry)
+		switch line[0] {
+		case '#':
+			parts := strings.SplitN(line, " ", 3)
+			if len(parts) != 3 {
+				continue
+			}
+			switch parts[1] {
+			case "branch.oid":
+				if parts[2] != "(initial)" {
+					res.SHA = parts[2]
+				}
+			case "branch.head":
+				if parts[2] == "(detached)" {
+					res.Detached = true
+				} else {
+					res.Branch = parts[2]
+				}
+			case "branch.upstream":
+				res.Upstream = parts[2]
+			case "branch.ab":
+				for _, ab := range strings.Fields(parts[2]) {
+					if strings.HasPrefix(ab, "+") {
+						res.Ahead = atoiDefault(ab[1:], 0)
+					} else if strings.HasPrefix(ab, "-") {
+						res.Behind = atoiDefault(ab[1:], 0)
+					}
+				}
+			}
+			continue
+		case '1':
+			// 1 XY sub mH mI mW hH hI path
+			parts := strings.SplitN(line, " ", 9)
+			if len(parts) != 9 {
+				continue
+			}
+			entry.IndexState = fileState(parts[1][0])
+			entry.WorktreeState = fileState(parts[1][1])
+			entry.Submodule = parseSubmoduleState(parts[2])
+			entry.Path = parts[8]
+		case '2':
+			// 2 XY sub mH mI mW hH hI Xscore path NUL origPath
+			parts := strings.SplitN(line, " ", 10)
+			if len(parts) != 10 || i+1 >= len(records) {
+				continue
+			}
+			entry.IndexState = fileState(parts[1][0])
+			entry.WorktreeState = fileState(parts[1][1])
+			entry.Submodule = parseSubmoduleState(parts[2])
+			entry.Score, _ = strconv.Atoi(parts[8][1:])
+			entry.Path = parts[9]
+			i++
+			entry.OrigPath = records[i]
+		case 'u':
+			// u XY sub m1 m2 m3 mW h1 h2 h3 path
+			parts := strings.SplitN(line, " ", 11)
+			if len(parts) != 11 {
+				continue
+			}
+			entry.IndexState = fileState(parts[1][0])
+			entry.WorktreeState = fileState(parts[1][1])
+			entry.Submodule = parseSubmoduleState(parts[2])
+			entry.Path = parts[10]
+			res.Unmerged = append(res.Unmerged, entry)
+			all = append(all, entry)
+			continue
+		case '?', '!':
+			entry.IndexState = FileState(line[0])
+			entry.WorktreeState = FileState(line[0])
+			entry.Path = line[2:]
+			if line[0] == '!' {
+				res.Ignored = append(res.Ignored, entry)
+				continue
+			}
+			res.Untracked = append(res.Untracked, entry)
+			all = append(all, entry)
+			continue
+		default:
+			continue
+		}
+		if entry.IndexState != StateUnmodified {
+			res.Staged = append(res.Staged, entry)
+		}
+		if entry.WorktreeState != StateUnmodified {
+			res.Unstaged = append(res.Unstaged, entry)
+		}
+		all = append(all, entry)
+	}
+	return res, all
+}
+
+// StatusOptions controls how much work git status does.
+type StatusOptions struct {
+	// Untracked is passed as --untracked-files: "no" skips looking for
+	// untracked files at all, which is much quicker in big working trees,
+	// "normal" lists untracked directories without looking inside them,
+	// and "all" lists every untracked file.  If empty, git decides.
+	Untracked string
+	// IgnoreSubmodules is passed as --ignore-submodules: "untracked",
+	// "dirty", or "all" leave out submodules with untracked files,
+	// with changes to their working trees, or with any changes at all.
+	IgnoreSubmodules string
+	// Ignored lists the ignored files as well.
+	Ignored bool
+	// Paths limits the status to these pathspecs.
+	Paths []string
+}
+
+func (o StatusOptions) args() []string {
+	args := []string{"--porcelain=v2", "-z"}
+	if o.Untracked != "" {
+		args = append(args, "--untracked-files="+o.Untracked)
+	}
+	if o.IgnoreSubmodules != "" {
+		args = append(args, "--ignore-submodules="+o.IgnoreSubmodules)
+	}
+	if o.Ignored {
+		args = append(args, "--ignored")
+	}
+	return append(append(args, "--"), o.Paths...)
+}
+
+// Status gets the state of the index and working tree, including
+// the state of the current branch relative to its upstream.
+// If pathspecs are passed, only the paths they match are looked at.
+func (r *Repo) Status(pathspecs ...string) (res *Status, err error) {
+	return r.StatusWithOptions(StatusOptions{Ignored: true, Paths: pathspecs})
+}
+
+// StatusWithOptions gets the state of the index and working tree, like Status.
+func (r *Repo) StatusWithOptions(opts StatusOptions) (res *Status, err error) {
+	cmd, out, _ := r.Git("status", append([]string{"--branch"}, opts.args()...)...)
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	res, _ = parseStatus(out.String())
+	return res, nil
+}
+
+// Clean tests to see if there are no changes of any kind,
+// not counting ignored files.
+func (s *Status) Clean() bool {
+	return len(s.Staged) == 0 && len(s.Unstaged) == 0 && len(s.Unmerged) == 0 && len(s.Untracked) == 0
+}
@@ -0,0 +1,151 @@
+package git
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Submodule is the state of a single submodule, as git submodule status sees it.
+type Submodule struct {
+	Path string
+	// SHA is the commit checked out in the submodule, or the commit
+	// the superproject wants if the submodule is not initialized.
+	SHA string
+	// Status is the status flag: ' ' if the submodule is up to date,
+	// '-' if it is not initialized, '+' if it has a different commit
+	// checked out than the superproject wants, and 'U' if it has
+	// merge conflicts.
+	Status byte
+}
+
+// Submodules returns the state of the submodules of this repository.
+func (r *Repo) Submodules(recursive bool) (res []Submodule, err error) {
+	args := []string{"status"}
+	if recursive {
+		args = append(args, "--recursive")
+	}
+	cmd, out, _ := r.Git("submodule", args...)
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	return parseSubmoduleStatus(out), nil
+}
+
+// parseSubmoduleStatus parses the output of git submodule status.
+func parseSubmoduleStatus(out io.Reader) (res []Submodule) {
+	res = make([]Submodule, 0)
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) < 2 {
+			continue
+		}
+		// <status><sha> SP <path>, followed by SP (<describe>) for
+		// initialized submodules.  Paths can have spaces in them,
+		// so only the SHA is split off.
+		fields := strings.SplitN(line[1:], " ", 2)
+		if len(fields) < 2 {
+			continue
+		}
+		path := fields[1]
+		if (line[0] == ' ' || line[0] == '+') && strings.HasSuffix(path, ")") {
+			if idx := strings.LastIndex(path, " ("); idx != -1 {
+				path = path[:idx]
+			}
+		}
+		res = append(res, Submodule{Path: path, SHA: fields[0], Status: line[0]})
+	}
+	return res
+}
+
+// SubmoduleUpdateOptions controls how UpdateSubmodules updates submodules.
+type SubmoduleUpdateOptions struct {
+	// Init initializes any submodules that have not been yet.
+	Init bool
+	// Recursive updates submodules of submodules as well.
+	Recursive bool
+	// Depth makes shallow clones of submodules with this many commits.
+	Depth int
+	// Jobs is how many submodules to fetch and clone in parallel.
+	// If 0, git decides (usually one at a time).
+	Jobs int
+	// RecommendShallow makes shallow clones of the submodules that
+	// .gitmodules says should be shallow.
+	RecommendShallow bool
+	// Remote updates submodules to their remote-tracking branch
+	// instead of the commit the superproject records.
+	Remote bool
+}
+
+func (o SubmoduleUpdateOptions) args() []string {
+	args := []string{"update", "--quiet"}
+	if o.Init {
+		args = append(args, "--init")
+	}
+	if o.Recursive {
+		args = append(args, "--recursive")
+	}
+	if o.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(o.Depth))
+	}
+	if o.Jobs > 0 {
+		args = append(args, "--jobs", strconv.Itoa(o.Jobs))
+	}
+	if o.RecommendShallow {
+		args = append(args, "--recommend-shallow")
+	}
+	if o.Remote {
+		args = append(args, "--remote")
+	}
+	return args
+}
+
+// SubmoduleResult is what happened to one submodule during UpdateSubmodules.
+type SubmoduleResult struct {
+	Path string
+	// Old and New are the commits checked out before and after the update.
+	// Old is empty if the submodule was not initialized.
+	Old, New string
+	// Ok is false if the submodule did not end up up to date.
+	Ok bool
+}
+
+// Updated tests to see if the update changed what was checked out.
+func (s SubmoduleResult) Updated() bool {
+	return s.Old != s.New
+}
+
+// UpdateSubmodules updates the submodules of this repository.
+// It returns a result for each submodule, even if the update failed for
+// some of them, in which case the error from git is returned as well.
+func (r *Repo) UpdateSubmodules(opts SubmoduleUpdateOptions) (res []SubmoduleResult, err error) {
+	before, err := r.Submodules(opts.Recursive)
+	if err != nil {
+		return nil, err
+	}
+	old := make(map[string]string)
+	for _, sub := range before {
+		if sub.Status != '-' {
+			old[sub.Path] = sub.SHA
+		}
+	}
+	cmd, _, _ := r.Git("submodule", opts.args()...)
+	updateErr := run(cmd)
+	after, err := r.Submodules(opts.Recursive)
+	if err != nil {
+		return nil, err
+	}
+	res = make([]SubmoduleResult, 0, len(after))
+	for _, sub := range after {
+		res = append(res, SubmoduleResult{
+			Path: sub.Path,
+			Old:  old[sub.Path],
+			New:  sub.SHA,
+			// --remote leaves submodules ahead of what the superproject records.
+			Ok: sub.Status == ' ' || (opts.Remote && sub.Status == '+'),
+		})
+	}
+	return res, updateErr
+}
@@ -0,0 +1,32 @@
+package git
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSubmoduleStatus(t *testing.T) {
+	const sha = "0123456789abcdef0123456789abcdef01234567"
+	for _, tc := range []struct {
+		line   string
+		path   string
+		status byte
+	}{
+		{" " + sha + " lib (heads/main)", "lib", ' '},
+		{" " + sha + " my lib (heads/main)", "my lib", ' '},
+		{"+" + sha + " a (b) c (v1.0-2-g0123456)", "a (b) c", '+'},
+		{" " + sha + " plain", "plain", ' '},
+		{"-" + sha + " not yet", "not yet", '-'},
+		{"-" + sha + " odd (name)", "odd (name)", '-'},
+		{"U" + sha + " conflicted one", "conflicted one", 'U'},
+	} {
+		res := parseSubmoduleStatus(strings.NewReader(tc.line + "\n"))
+		if len(res) != 1 {
+			t.Errorf("%q: got %d submodules", tc.line, len(res))
+			continue
+		}
+		if res[0].Path != tc.path || res[0].SHA != sha || res[0].Status != tc.status {
+			t.Errorf("%q: got %+v", tc.line, res[0])
+		}
+	}
+}
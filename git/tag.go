@@ -0,0 +1,171 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TagOptions controls what sort of tag TagWithOptions creates.
+// The zero value makes a lightweight tag, just like Tag.
+type TagOptions struct {
+	// Message makes an annotated tag with this message.
+	Message string
+	// Sign makes a signed tag, with the default key for the tagger
+	// or with SigningKey if it is set.  Signed tags need a Message.
+	Sign       bool
+	SigningKey string
+	// Force replaces the tag if it already exists.
+	Force bool
+}
+
+func (o TagOptions) args() []string {
+	args := []string{}
+	switch {
+	case o.SigningKey != "":
+		args = append(args, "-u", o.SigningKey)
+	case o.Sign:
+		args = append(args, "-s")
+	case o.Message != "":
+		args = append(args, "-a")
+	}
+	if o.Message != "" {
+		args = append(args, "-m", o.Message)
+	}
+	if o.Force {
+		args = append(args, "--force")
+	}
+	return args
+}
+
+// TagWithOptions creates a tag with the given name based on base,
+// which is handled just like it is for Tag.
+func (r *Repo) TagWithOptions(name string, base interface{}, opts TagOptions) (ref *Ref, err error) {
+	if (opts.Sign || opts.SigningKey != "") && opts.Message == "" {
+		return nil, fmt.Errorf("Signed tag %s needs a message.", name)
+	}
+	return r.makeRef("tag", name, base, opts.args()...)
+}
+
+// TagWithOptions creates a new tag at this ref.
+func (r *Ref) TagWithOptions(name string, opts TagOptions) (ref *Ref, err error) {
+	return r.r.TagWithOptions(name, r, opts)
+}
+
+// TagInfo holds the contents of an annotated tag object.
+type TagInfo struct {
+	// SHA is the SHA of the tag object itself, and Name is the
+	// name it was created with.
+	SHA, Name string
+	// Target is the SHA of the object the tag points at,
+	// and TargetType is its type (usually "commit").
+	Target, TargetType string
+	Tagger             Signature
+	// Message is the tag message, without any signature.
+	Message string
+	// Signature is the signature block of a signed tag.
+	Signature string
+}
+
+// parseSignature parses the "Name <email> time zone" that git
+// puts in commit and tag headers.
+func parseSignature(val string) (res Signature) {
+	open, close := strings.Index(val, "<"), strings.LastIndex(val, ">")
+	if open < 0 || close < open {
+		res.Name = val
+		return res
+	}
+	res.Name = strings.TrimSpace(val[:open])
+	res.Email = val[open+1 : close]
+	if fields := strings.Fields(val[close+1:]); len(fields) > 0 {
+		res.When = parseTime(fields[0])
+	}
+	return res
+}
+
+// TagInfo reads the annotated tag object this ref points at.
+// Lightweight tags do not have a tag object, so TagInfo
+// returns an error for them.
+func (r *Ref) TagInfo() (res *TagInfo, err error) {
+	cmd, out, _ := r.r.Git("cat-file", "-t", r.SHA)
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	if kind := strings.TrimSpace(out.String()); kind != "tag" {
+		return nil, fmt.Errorf("%s is a %s, not an annotated tag.", r.Path, kind)
+	}
+	cmd, out, _ = r.r.Git("cat-file", "tag", r.SHA)
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	res = &TagInfo{SHA: r.SHA}
+	parts := strings.SplitN(out.String(), "\n\n", 2)
+	for _, line := range strings.Split(parts[0], "\n") {
+		kv := strings.SplitN(line, " ", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "object":
+			res.Target = kv[1]
+		case "type":
+			res.TargetType = kv[1]
+		case "tag":
+			res.Name = kv[1]
+		case "tagger":
+			res.Tagger = parseSignature(kv[1])
+		}
+	}
+	if len(parts) == 2 {
+		res.Message = parts[1]
+		for _, marker := range []string{"-----BEGIN PGP SIGNATURE-----", "-----BEGIN SSH SIGNATURE-----"} {
+			if idx := strings.Index(res.Message, marker); idx >= 0 {
+				res.Message, res.Signature = res.Message[:idx], res.Message[idx:]
+				break
+			}
+		}
+	}
+	return res, nil
+}
+
+// TagsByDate returns the tags whose names match pattern, newest first.
+// Annotated tags are dated by when they were tagged, and lightweight
+// tags by when the commit they point at was made.  pattern is a glob,
+// and an empty pattern matches every tag.
+func (r *Repo) TagsByDate(pattern string) (res RefSlice, err error) {
+	cmd, out, _ := r.Git("for-each-ref", "--sort=-creatordate",
+		"--format=%(objectname) %(refname)", "refs/tags/"+pattern)
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	res = make(RefSlice, 0, 10)
+	for _, line := range strings.Split(out.String(), "\n") {
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) == 2 {
+			res = append(res, &Ref{SHA: parts[0], Path: parts[1], r: r})
+		}
+	}
+	return res, nil
+}
+
+// Tags returns the tags that point at the commit this ref points at.
+// Annotated tags are included if the commit they tag is this one,
+// and if this ref is an annotated tag, the commit it tags is used.
+func (r *Ref) Tags() (res RefSlice, err error) {
+	target := r.SHA
+	if r.Peeled != "" {
+		target = r.Peeled
+	}
+	return r.r.listRefs("--points-at="+target, "refs/tags")
+}
+
+// LatestTag returns the newest tag whose name matches pattern.
+func (r *Repo) LatestTag(pattern string) (res *Ref, err error) {
+	tags, err := r.TagsByDate(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("No tags matching %q in %s", pattern, r.Path())
+	}
+	return tags[0], nil
+}
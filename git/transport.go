@@ -0,0 +1,203 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TransportKind is the sort of place a Transport talks to.
+type TransportKind int
+
+const (
+	// RemoteTransport is one of the repository's configured remotes.
+	RemoteTransport TransportKind = iota
+	// URLTransport is a URL (or scp-style address) that git knows how to talk to.
+	URLTransport
+	// PathTransport is a repository on the local filesystem.
+	PathTransport
+	// BundleTransport is a bundle file, as made by git bundle.
+	BundleTransport
+)
+
+func (k TransportKind) String() string {
+	switch k {
+	case RemoteTransport:
+		return "remote"
+	case URLTransport:
+		return "url"
+	case PathTransport:
+		return "path"
+	case BundleTransport:
+		return "bundle"
+	}
+	return "unknown"
+}
+
+// Transport is somewhere that refs can be fetched from or pushed to,
+// so that code does not have to care whether it is working with a
+// remote, a URL, a local repository, or a bundle.
+type Transport struct {
+	Kind TransportKind
+	// Spec is what gets passed to git to reach the transport:
+	// the name of a remote, a URL, or a path.
+	Spec string
+	r    *Repo
+}
+
+// Capabilities holds what Probe found out about a Transport.
+type Capabilities struct {
+	// Fetch is true if refs can be fetched from the transport.
+	Fetch bool
+	// Push is true if the transport accepted a dry-run push.
+	// Pushing to a bundle writes a new bundle in its place.
+	Push bool
+	// Refs holds the refs the transport advertises.
+	Refs []RemoteRef
+}
+
+func isBundle(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	line, _ := bufio.NewReader(f).ReadString('\n')
+	return strings.HasPrefix(line, "# v") && strings.HasSuffix(line, " git bundle\n")
+}
+
+func isSCPLike(spec string) bool {
+	idx := strings.Index(spec, ":")
+	return idx > 0 && !strings.Contains(spec[:idx], "/")
+}
+
+// localPath resolves spec the way git will, since git runs
+// in the repository and not in our working directory.
+func (r *Repo) localPath(spec string) string {
+	if filepath.IsAbs(spec) {
+		return spec
+	}
+	return filepath.Join(r.Path(), spec)
+}
+
+// Transport works out what spec refers to and returns a Transport for it.
+// spec is checked against our remotes first, then URLs, then paths
+// to local repositories and bundles.  A bundle does not have to exist
+// yet, as long as it is only pushed to.
+func (r *Repo) Transport(spec string) (t *Transport, err error) {
+	t = &Transport{Spec: spec, r: r}
+	switch {
+	case r.HasRemote(spec):
+		t.Kind = RemoteTransport
+	case strings.Contains(spec, "://"):
+		t.Kind = URLTransport
+	default:
+		path := r.localPath(spec)
+		fi, err := os.Stat(path)
+		switch {
+		case err == nil && fi.IsDir():
+			t.Kind = PathTransport
+		case err == nil && isBundle(path):
+			t.Kind = BundleTransport
+		case err == nil:
+			return nil, fmt.Errorf("%s is not a git repository or bundle", spec)
+		case isSCPLike(spec):
+			t.Kind = URLTransport
+		case strings.HasSuffix(spec, ".bundle"):
+			t.Kind = BundleTransport
+		default:
+			return nil, fmt.Errorf("%s is not a remote, URL, path, or bundle", spec)
+		}
+	}
+	return t, nil
+}
+
+// Probe asks the transport what refs it has, and works out
+// what can be done with it.
+func (t *Transport) Probe() (res Capabilities, err error) {
+	if t.Kind == BundleTransport {
+		if _, err := os.Stat(t.r.localPath(t.Spec)); os.IsNotExist(err) {
+			return Capabilities{Push: true}, nil
+		}
+	}
+	refs, err := t.r.LsRemote(t.Spec, LsRemoteOptions{})
+	if err != nil {
+		return res, err
+	}
+	return Capabilities{Fetch: true, Push: t.canPush(), Refs: refs}, nil
+}
+
+// probeRef is deleted by the dry-run push that canPush does.
+// It does not have to exist for the push to succeed.
+const probeRef = "refs/go-git-probe"
+
+// canPush tests whether the transport will take a push, by doing a
+// dry-run push that deletes probeRef.  That still has to talk to
+// the other side's receive-pack, so it fails if pushing is not
+// allowed, but it does not need anything to push.
+func (t *Transport) canPush() bool {
+	if t.Kind == BundleTransport {
+		return true
+	}
+	cmd, _, _ := t.r.Git("push", "--dry-run", "--porcelain", t.Spec, ":"+probeRef)
+	if t.r.Auth.Credentials != nil {
+		if err := t.r.Auth.provideCredentials(cmd, t.r.remoteURL(t.Spec, true)); err != nil {
+			return false
+		}
+	}
+	return run(cmd) == nil
+}
+
+// Fetch fetches refspecs from the transport.
+// With no refspecs, remotes use their configured fetch refspecs,
+// and everything else only updates FETCH_HEAD, just like git fetch.
+func (t *Transport) Fetch(refspecs ...string) (err error) {
+	cmd, _, _ := t.r.Git("fetch", append([]string{"-q", t.Spec}, refspecs...)...)
+	if err = run(cmd); err != nil {
+		return err
+	}
+	t.r.ReloadRefs()
+	return nil
+}
+
+// Push pushes refspecs to the transport.
+// Pushing to a bundle replaces it with a new bundle holding the refs
+// named by refspecs (which are passed to git bundle create, and
+// can include ranges), and opts are ignored.
+func (t *Transport) Push(refspecs []string, opts PushOptions) (res []PushResult, err error) {
+	if t.Kind != BundleTransport {
+		return t.r.Push(t.Spec, refspecs, opts)
+	}
+	if len(refspecs) == 0 {
+		return nil, fmt.Errorf("Nothing to write to bundle %s", t.Spec)
+	}
+	cmd, _, _ := t.r.Git("bundle", append([]string{"create", "-q", t.Spec}, refspecs...)...)
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	cmd, out, _ := t.r.Git("bundle", "list-heads", t.Spec)
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	res = make([]PushResult, 0, 1)
+	for _, ref := range parseBundleHeads(out.String()) {
+		res = append(res, PushResult{Flag: '*', Src: ref.Name, Dst: ref.Name, Summary: "[new bundle]"})
+	}
+	return res, nil
+}
+
+// bundle list-heads separates the SHA and the ref with a space,
+// not the tab that ls-remote uses.
+func parseBundleHeads(out string) (res []RemoteRef) {
+	res = make([]RemoteRef, 0, 1)
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), " ", 2)
+		if len(parts) == 2 {
+			res = append(res, RemoteRef{SHA: parts[0], Name: parts[1]})
+		}
+	}
+	return res
+}
@@ -0,0 +1,40 @@
+package git
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestTransportProbePush(t *testing.T) {
+	up, err := Init(filepath.Join(t.TempDir(), "up.git"), "--bare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newRepo(t)
+	sh(t, r, "remote", "add", "rw", up.GitDir)
+	sh(t, r, "remote", "add", "ro", up.GitDir)
+	// A remote whose receive-pack always fails stands in
+	// for one that only allows fetching.
+	sh(t, r, "config", "remote.ro.receivepack", "false")
+	r.ReloadConfig()
+	for _, tc := range []struct {
+		spec string
+		push bool
+	}{
+		{"rw", true},
+		{"ro", false},
+		{up.GitDir, true},
+	} {
+		tr, err := r.Transport(tc.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := tr.Probe()
+		if err != nil {
+			t.Fatalf("%s: %v", tc.spec, err)
+		}
+		if !c.Fetch || c.Push != tc.push {
+			t.Errorf("%s: Probe = %+v, want Push %v", tc.spec, c, tc.push)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TreeEntry is an entry in a tree object.
+type TreeEntry struct {
+	// Mode is the file mode git records, like "100644" for a file,
+	// "100755" for an executable, "120000" for a symlink,
+	// "040000" for a directory, and "160000" for a submodule.
+	Mode string
+	// Type is "blob", "tree", or "commit" (for submodules).
+	Type string
+	SHA  string
+	// Size is the size of a blob.  It is -1 for trees and submodules.
+	Size int64
+	Path string
+}
+
+// treeEntryType works out the object type an entry with mode points at.
+func treeEntryType(mode string) string {
+	switch mode {
+	case "040000", "40000":
+		return "tree"
+	case "160000":
+		return "commit"
+	}
+	return "blob"
+}
+
+// WriteTree writes a tree object holding entries, and returns its SHA.
+// Entries can have paths with slashes in them, in which case the
+// trees for the directories are written as well.  If Mode is empty
+// it defaults to "100644", and if Type is empty it is worked out
+// from Mode.  The objects the entries point at must already exist,
+// and the working tree and index are left alone.
+func (r *Repo) WriteTree(entries []TreeEntry) (sha string, err error) {
+	buf := &bytes.Buffer{}
+	dirs := make([]string, 0)
+	subtrees := make(map[string][]TreeEntry)
+	for _, entry := range entries {
+		path := strings.Trim(entry.Path, "/")
+		if path == "" {
+			return "", fmt.Errorf("Tree entry %s has no path!", entry.SHA)
+		}
+		if parts := strings.SplitN(path, "/", 2); len(parts) == 2 {
+			if _, ok := subtrees[parts[0]]; !ok {
+				dirs = append(dirs, parts[0])
+			}
+			entry.Path = parts[1]
+			subtrees[parts[0]] = append(subtrees[parts[0]], entry)
+			continue
+		}
+		if entry.Mode == "" {
+			entry.Mode = "100644"
+		}
+		if entry.Type == "" {
+			entry.Type = treeEntryType(entry.Mode)
+		}
+		fmt.Fprintf(buf, "%s %s %s\t%s\x00", entry.Mode, entry.Type, entry.SHA, path)
+	}
+	for _, dir := range dirs {
+		sub, err := r.WriteTree(subtrees[dir])
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(buf, "040000 tree %s\t%s\x00", sub, dir)
+	}
+	cmd, out, _ := r.GitWithInput(buf, "mktree", "-z")
+	if err = run(cmd); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// parseTreeEntry parses an entry from git ls-tree -l -z:
+// <mode> SP <type> SP <sha> SP+ <size> TAB <path>
+func parseTreeEntry(record string) (res TreeEntry, ok bool) {
+	parts := strings.SplitN(record, "\t", 2)
+	if len(parts) != 2 {
+		return res, false
+	}
+	fields := strings.Fields(parts[0])
+	if len(fields) != 4 {
+		return res, false
+	}
+	res = TreeEntry{Mode: fields[0], Type: fields[1], SHA: fields[2], Size: -1, Path: parts[1]}
+	if size, err := strconv.ParseInt(fields[3], 10, 64); err == nil {
+		res.Size = size
+	}
+	return res, true
+}
+
+// Tree lists what is in the directory at path in this ref.
+// An empty path lists the top of the tree.  The entries have
+// paths from the top of the tree, not from path.
+func (r *Ref) Tree(path string) (res []TreeEntry, err error) {
+	args := []string{"-z", "-l", "--full-tree", r.SHA}
+	if path = strings.Trim(path, "/"); path != "" {
+		args = append(args, "--", path+"/")
+	}
+	cmd, out, _ := r.r.Git("ls-tree", args...)
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	res = make([]TreeEntry, 0)
+	for _, record := range strings.Split(out.String(), "\x00") {
+		if entry, ok := parseTreeEntry(record); ok {
+			res = append(res, entry)
+		}
+	}
+	if len(res) == 0 && path != "" {
+		return nil, fmt.Errorf("%s is not a directory in %s", path, r.Path)
+	}
+	return res, nil
+}
+
+// ErrStopWalk can be returned by the function passed to Walk
+// to stop walking the tree without Walk returning an error.
+var ErrStopWalk = errors.New("stop walking tree")
+
+// Walk calls fn with every file (and submodule) in this ref, as git
+// streams them out of ls-tree, so that huge trees do not need to be
+// loaded into memory.  Directories are not passed to fn.
+// If fn returns an error, Walk stops and returns it,
+// unless it is ErrStopWalk.
+func (r *Ref) Walk(fn func(TreeEntry) error) (err error) {
+	cmd, _, _ := r.r.Git("ls-tree", "-r", "-z", "-l", "--full-tree", r.SHA)
+	cmd.Stdout = nil
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(out)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	scanner.Split(scanNUL)
+	for scanner.Scan() {
+		entry, ok := parseTreeEntry(scanner.Text())
+		if !ok {
+			continue
+		}
+		if err = fn(entry); err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			if err == ErrStopWalk {
+				return nil
+			}
+			return err
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	return wait(cmd)
+}
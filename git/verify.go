@@ -0,0 +1,108 @@
+package git
+
+import (
+	"errors"
+	"strings"
+)
+
+// Verification is what git found out about the signature on a commit or tag.
+type Verification struct {
+	// Signed is true if the object has a signature at all,
+	// and Valid is true if the signature is good.
+	Signed, Valid bool
+	// KeyID and Fingerprint identify the key that made the signature,
+	// as far as the signing tool reports them.
+	KeyID, Fingerprint string
+	// Signer is who the key belongs to.
+	Signer string
+	// Trust is the trust level of the key, such as "ultimate",
+	// "fully", "marginal", "never", or "undefined".
+	// It is empty if the signing tool does not report one.
+	Trust string
+	// Raw is everything the signing tool printed.
+	Raw string
+}
+
+// parseVerification parses the output of git verify-commit --raw
+// and git verify-tag --raw.  GPG prints machine-readable [GNUPG:]
+// status lines, and SSH signatures get a single line from ssh-keygen.
+func parseVerification(out string) (res *Verification) {
+	res = &Verification{Raw: out}
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "Good \"git\" signature for ") {
+			// Good "git" signature for <principal> with <type> key <fingerprint>
+			res.Signed, res.Valid = true, true
+			rest := strings.TrimPrefix(line, "Good \"git\" signature for ")
+			if idx := strings.Index(rest, " with "); idx >= 0 {
+				res.Signer = rest[:idx]
+				fields := strings.Fields(rest[idx:])
+				res.KeyID = fields[len(fields)-1]
+				res.Fingerprint = res.KeyID
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "Could not verify signature") ||
+			strings.Contains(line, "Signature verification failed") {
+			res.Signed = true
+			continue
+		}
+		if !strings.HasPrefix(line, "[GNUPG:] ") {
+			continue
+		}
+		fields := strings.SplitN(strings.TrimPrefix(line, "[GNUPG:] "), " ", 3)
+		switch fields[0] {
+		case "GOODSIG", "BADSIG", "EXPSIG", "EXPKEYSIG", "REVKEYSIG":
+			res.Signed = true
+			res.Valid = fields[0] == "GOODSIG"
+			if len(fields) > 1 {
+				res.KeyID = fields[1]
+			}
+			if len(fields) > 2 {
+				res.Signer = fields[2]
+			}
+		case "ERRSIG", "NO_PUBKEY":
+			res.Signed = true
+			if len(fields) > 1 && res.KeyID == "" {
+				res.KeyID = fields[1]
+			}
+		case "VALIDSIG":
+			if len(fields) > 1 {
+				res.Fingerprint = fields[1]
+			}
+		case "TRUST_UNDEFINED", "TRUST_NEVER", "TRUST_MARGINAL", "TRUST_FULLY", "TRUST_ULTIMATE":
+			res.Trust = strings.ToLower(strings.TrimPrefix(fields[0], "TRUST_"))
+		}
+	}
+	return res
+}
+
+func (r *Ref) verify(how string) (res *Verification, err error) {
+	cmd, _, stderr := r.r.Git(how, "--raw", r.SHA)
+	err = run(cmd)
+	res = parseVerification(stderr.String())
+	if err == nil || res.Signed {
+		return res, nil
+	}
+	// Unsigned commits fail without a word, and unsigned tags
+	// complain that there is no signature.
+	var gitErr *GitError
+	if errors.As(err, &gitErr) && gitErr.ExitCode == 1 &&
+		(strings.TrimSpace(gitErr.Stderr) == "" || strings.Contains(gitErr.Stderr, "no signature found")) {
+		return res, nil
+	}
+	return nil, err
+}
+
+// VerifyCommit checks the signature on the commit this ref points at.
+// An unsigned commit or a bad signature is not an error,
+// the returned Verification says what was wrong.
+func (r *Ref) VerifyCommit() (res *Verification, err error) {
+	return r.verify("verify-commit")
+}
+
+// VerifyTag checks the signature on the annotated tag this ref points at.
+// An unsigned tag or a bad signature is not an error,
+// the returned Verification says what was wrong.
+func (r *Ref) VerifyTag() (res *Verification, err error) {
+	return r.verify("verify-tag")
+}
@@ -0,0 +1,209 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Worktree is a working tree attached to a repository.
+// Every non-bare repository has a main worktree, and can have
+// any number of linked worktrees created by AddWorktree.
+type Worktree struct {
+	// Path is the top of the working tree.
+	Path string
+	// HEAD is the SHA of the commit checked out in the worktree.
+	HEAD string
+	// Branch is the full name of the branch checked out in the
+	// worktree, if the worktree is not detached.
+	Branch         string
+	Bare, Detached bool
+	// Locked is true if the worktree is locked, and LockReason
+	// holds the reason it was locked with, if any.
+	Locked     bool
+	LockReason string
+	// Prunable is true if git thinks the worktree is stale.
+	Prunable bool
+	r        *Repo
+}
+
+// WorktreeOptions controls how AddWorktree creates a worktree.
+type WorktreeOptions struct {
+	// NewBranch, if not empty, creates a new branch with this name
+	// starting at the ref and checks it out in the worktree.
+	NewBranch string
+	// Detach checks out the ref with a detached HEAD.
+	Detach bool
+	// Force creates the worktree even if the branch is already
+	// checked out somewhere else.
+	Force bool
+	// Lock locks the worktree as soon as it is created.
+	Lock bool
+}
+
+func parseWorktrees(r *Repo, out string) (res []*Worktree) {
+	res = make([]*Worktree, 0, 1)
+	var wt *Worktree
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), " ", 2)
+		val := ""
+		if len(parts) == 2 {
+			val = parts[1]
+		}
+		switch parts[0] {
+		case "worktree":
+			wt = &Worktree{Path: val, r: r}
+			res = append(res, wt)
+		case "HEAD":
+			wt.HEAD = val
+		case "branch":
+			wt.Branch = val
+		case "bare":
+			wt.Bare = true
+		case "detached":
+			wt.Detached = true
+		case "locked":
+			wt.Locked = true
+			wt.LockReason = val
+		case "prunable":
+			wt.Prunable = true
+		}
+	}
+	return res
+}
+
+// Worktrees lists the worktrees attached to this repository,
+// starting with the main one.
+func (r *Repo) Worktrees() (res []*Worktree, err error) {
+	cmd, out, _ := r.Git("worktree", "list", "--porcelain")
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	return parseWorktrees(r, out.String()), nil
+}
+
+// AddWorktree creates a new linked worktree at path with ref checked out.
+func (r *Repo) AddWorktree(path string, ref *Ref, opts WorktreeOptions) (wt *Worktree, err error) {
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"add"}
+	if opts.NewBranch != "" {
+		args = append(args, "-b", opts.NewBranch)
+	}
+	if opts.Detach {
+		args = append(args, "--detach")
+	}
+	if opts.Force {
+		args = append(args, "--force")
+	}
+	if opts.Lock {
+		args = append(args, "--lock")
+	}
+	args = append(args, path)
+	if ref != nil {
+		if ref.IsLocal() && opts.NewBranch == "" && !opts.Detach {
+			args = append(args, ref.Name())
+		} else {
+			args = append(args, ref.SHA)
+		}
+	}
+	cmd, _, _ := r.Git("worktree", args...)
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	r.ReloadRefs()
+	worktrees, err := r.Worktrees()
+	if err != nil {
+		return nil, err
+	}
+	for _, wt := range worktrees {
+		if wt.Path == path {
+			return wt, nil
+		}
+		// git reports the path with symlinks resolved.
+		if resolved, err := filepath.EvalSymlinks(path); err == nil && wt.Path == resolved {
+			return wt, nil
+		}
+	}
+	return nil, fmt.Errorf("Created worktree at %s, but git does not know about it!", path)
+}
+
+// Repo returns a Repo that operates on this worktree.
+func (w *Worktree) Repo() (res *Repo, err error) {
+	if w.Bare {
+		return w.r, nil
+	}
+	cmd, out, _ := Git("rev-parse", "--absolute-git-dir")
+	cmd.Dir = w.Path
+	if err = run(cmd); err != nil {
+		return nil, err
+	}
+	return &Repo{
+		GitDir:          strings.TrimSpace(out.String()),
+		WorkDir:         w.Path,
+		NoAdvice:        w.r.NoAdvice,
+		Profile:         w.r.Profile,
+		Auth:            w.r.Auth,
+		AutoCommitGraph: w.r.AutoCommitGraph,
+		overrides:       w.r.overrides,
+	}, nil
+}
+
+// Remove removes this worktree.  Unless force is true, git will refuse
+// to remove a worktree that has local changes or is locked.
+func (w *Worktree) Remove(force bool) (err error) {
+	args := []string{"remove"}
+	if force {
+		args = append(args, "--force")
+	}
+	cmd, _, _ := w.r.Git("worktree", append(args, w.Path)...)
+	return run(cmd)
+}
+
+// Lock locks this worktree so that it cannot be pruned,
+// moved, or removed.
+func (w *Worktree) Lock(reason string) (err error) {
+	args := []string{"lock"}
+	if reason != "" {
+		args = append(args, "--reason", reason)
+	}
+	cmd, _, _ := w.r.Git("worktree", append(args, w.Path)...)
+	if err = run(cmd); err != nil {
+		return err
+	}
+	w.Locked, w.LockReason = true, reason
+	return nil
+}
+
+// Unlock unlocks this worktree.
+func (w *Worktree) Unlock() (err error) {
+	cmd, _, _ := w.r.Git("worktree", "unlock", w.Path)
+	if err = run(cmd); err != nil {
+		return err
+	}
+	w.Locked, w.LockReason = false, ""
+	return nil
+}
+
+// Prune cleans up the information git keeps about this worktree,
+// once its working tree has been deleted.
+// It returns an error if git does not think the worktree is stale.
+// Since git worktree prune works on the whole repository,
+// any other stale worktrees will be cleaned up as well.
+func (w *Worktree) Prune() (err error) {
+	if !w.Prunable {
+		return fmt.Errorf("Worktree at %s is not prunable", w.Path)
+	}
+	return w.r.PruneWorktrees()
+}
+
+// PruneWorktrees cleans up the information git keeps about
+// worktrees whose working trees have been deleted.
+func (r *Repo) PruneWorktrees() (err error) {
+	cmd, _, _ := r.Git("worktree", "prune")
+	return run(cmd)
+}